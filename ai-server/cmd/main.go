@@ -2,94 +2,191 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/dmh2000/ai-server/config"
 	"github.com/dmh2000/ai-server/internal/ai"
+	"github.com/dmh2000/ai-server/internal/delivery"
+	"github.com/dmh2000/ai-server/internal/llm"
 	"github.com/dmh2000/ai-server/internal/logger"
+	"github.com/dmh2000/ai-server/internal/persona"
+	"github.com/dmh2000/ai-server/internal/prompt"
 	"github.com/dmh2000/ai-server/internal/server"
-	"github.com/dmh2000/ai-server/internal/types"
+	"github.com/dmh2000/ai-server/internal/session"
+	"github.com/dmh2000/ai-server/internal/transcript"
+	"github.com/dmh2000/ai-server/internal/tts"
+	"github.com/dmh2000/ai-server/internal/window"
 )
 
 func main() {
 	logger.Println("Starting AI Server...")
 
 	// Load configuration
-	cfg := config.Load()
-	logger.Printf("Configuration: Alice port=%d, Bob port=%d", cfg.AlicePort, cfg.BobPort)
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Printf("Failed to load configuration: %v", err)
+		os.Exit(1)
+	}
+	logger.Printf("Configuration: address=%s:%d, default personas=%s/%s", cfg.Host, cfg.Port,
+		cfg.DefaultAsker, cfg.DefaultAnswerer)
+
+	// Define the personas conversations can be held between
+	personas, err := newRegistry(cfg)
+	if err != nil {
+		logger.Printf("Failed to load personas: %v", err)
+		os.Exit(1)
+	}
+	if _, err := personas.Pair(cfg.DefaultAsker, cfg.DefaultAnswerer); err != nil {
+		logger.Printf("Invalid default personas: %v", err)
+		os.Exit(1)
+	}
+	if _, err := ai.NewScheduler(cfg.RoundTableStrategy, nil, llm.Settings{}); err != nil {
+		logger.Printf("Invalid round table strategy: %v", err)
+		os.Exit(1)
+	}
+	channelPolicies, err := delivery.ParsePolicies(cfg.ChannelPolicies)
+	if err != nil {
+		logger.Printf("Invalid channel policies: %v", err)
+		os.Exit(1)
+	}
+	contextWindow := window.Options{
+		Strategy:  cfg.ContextStrategy,
+		MaxTokens: cfg.ContextMaxTokens,
+		Counter:   tokenCounter(cfg.TokenEncoding),
+	}
+	if _, err := window.New(contextWindow, nil, llm.Settings{}); err != nil {
+		logger.Printf("Invalid context strategy: %v", err)
+		os.Exit(1)
+	}
+	for _, p := range personas.All() {
+		logger.Printf("Persona %s: %s, %s/%s", p.Name, p.Role, p.Provider, p.Settings.Model)
+	}
 
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Create channels for communication
-	// BobServer <-> BobAI
-	bobServerToAI := make(chan string, cfg.ChannelBuffer)
-	bobAIToServer := make(chan types.ConversationMessage, cfg.ChannelBuffer)
-
-	// AliceServer <-> AliceAI
-	aliceServerToAI := make(chan string, cfg.ChannelBuffer)
-	aliceAIToServer := make(chan types.ConversationMessage, cfg.ChannelBuffer)
+	// Create the session manager; each conversation gets its own asker/answerer pair
+	newBackend, err := backendFactory(cfg, personas)
+	if err != nil {
+		logger.Printf("Failed to create LLM backends: %v", err)
+		os.Exit(1)
+	}
+	var transcripts *transcript.Store
+	if cfg.TranscriptDir != "" {
+		transcripts, err = transcript.NewStore(cfg.TranscriptDir)
+		if err != nil {
+			logger.Printf("Failed to open transcript directory: %v", err)
+			os.Exit(1)
+		}
+		logger.Printf("Recording transcripts in %s", cfg.TranscriptDir)
+	}
+	speech, err := newSpeech(cfg, personas)
+	if err != nil {
+		logger.Printf("Failed to create TTS engine: %v", err)
+		os.Exit(1)
+	}
+	var prompts *prompt.Store
+	if cfg.PromptDir != "" {
+		prompts = prompt.NewStore(cfg.PromptDir, promptPersonas(personas))
+		logger.Printf("Reading system prompts from %s", cfg.PromptDir)
+	}
+	sessions := session.NewManager(session.Options{
+		ChannelBuffer: cfg.ChannelBuffer,
+		Delivery: delivery.Options{
+			Policies: channelPolicies,
+			Timeout:  time.Duration(cfg.ChannelTimeoutMs) * time.Millisecond,
+		},
+		Limits: ai.Limits{
+			MaxTurns:    cfg.MaxTurns,
+			MaxDuration: time.Duration(cfg.MaxDurationSec) * time.Second,
+			MaxTokens:   cfg.MaxTokens,
+		},
+		IdleTimeout: time.Duration(cfg.SessionIdleTimeoutSec) * time.Second,
+		MaxSessions: cfg.MaxSessions,
+		Transcripts: transcripts,
+		Speaker:     speaker(speech),
+		Prompts:     promptSource(prompts),
+		Window:      contextWindow,
 
-	// BobAI -> AliceAI
-	bobToAlice := make(chan types.ConversationMessage, cfg.ChannelBuffer)
+		Personas:        personas,
+		DefaultAsker:    cfg.DefaultAsker,
+		DefaultAnswerer: cfg.DefaultAnswerer,
+		DefaultStrategy: cfg.RoundTableStrategy,
 
-	// AliceAI -> BobAI (for context)
-	aliceToBob := make(chan types.ConversationMessage, cfg.ChannelBuffer)
+		HumanTimeout: time.Duration(cfg.HumanTimeoutSec) * time.Second,
+	}, newBackend)
 
 	// Create server instances
-	aliceServer := server.NewAliceServer(cfg.AlicePort, aliceServerToAI, aliceAIToServer)
-	bobServer := server.NewBobServer(cfg.BobPort, bobServerToAI, bobAIToServer)
-
-	// Create AI instances
-	aliceAI := ai.NewAliceAI(aliceServerToAI, aliceAIToServer, bobToAlice, aliceToBob)
-	bobAI := ai.NewBobAI(bobServerToAI, bobAIToServer, bobToAlice, aliceToBob)
-
-	// Set up reset callbacks - both servers reset both AIs
-	resetBothAIs := func() {
-		aliceAI.Reset()
-		bobAI.Reset()
-		logger.Println("Both AI contexts have been reset")
+	serverOpts := server.Options{
+		QueueSize:      cfg.ClientQueueSize,
+		Transcripts:    transcripts,
+		ReplayInterval: time.Duration(cfg.ReplayIntervalMs) * time.Millisecond,
 	}
-	aliceServer.SetResetCallback(resetBothAIs)
-	bobServer.SetResetCallback(resetBothAIs)
+	answererServer := server.New(server.AnswererRole, sessions, serverOpts)
+	askerServer := server.New(server.AskerRole, sessions, serverOpts)
+	roundTableServer := server.New(server.ModeratorRole, sessions, serverOpts)
 
-	// When Bob starts a new conversation, resume Alice
-	bobAI.SetStartNewConvCallback(func() {
-		aliceAI.Resume()
-		logger.Println("Alice AI resumed for new conversation")
-	})
+	// Route everything through one HTTP server. The Alice and Bob clients
+	// connect to their original paths, whichever personas they are watching.
+	httpServer := server.NewHTTPServer(cfg.Host, cfg.Port)
+	httpServer.Handle("/ws/answerer", answererServer)
+	httpServer.Handle("/ws/asker", askerServer)
+	httpServer.Handle("/ws/alice", answererServer)
+	httpServer.Handle("/ws/bob", askerServer)
+	httpServer.Handle("/ws/roundtable", roundTableServer)
+	if transcripts != nil {
+		httpServer.HandleTranscripts(transcripts)
+	}
+	if speech != nil {
+		httpServer.HandleStatic("/audio/", cfg.AudioDir)
+	}
+	if cfg.AliceStaticDir != "" {
+		httpServer.HandleStatic("/alice/", cfg.AliceStaticDir)
+	}
+	if cfg.BobStaticDir != "" {
+		httpServer.HandleStatic("/bob/", cfg.BobStaticDir)
+	}
 
 	// WaitGroup for graceful shutdown
 	var wg sync.WaitGroup
 
-	// Start AI components
-	wg.Add(2)
+	// Start session manager (runs the AI components of every conversation)
+	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		aliceAI.Start(ctx)
-	}()
-	go func() {
-		defer wg.Done()
-		bobAI.Start(ctx)
+		sessions.Start(ctx)
 	}()
 
-	// Start servers in goroutines
-	wg.Add(2)
-	go func() {
-		defer wg.Done()
-		if err := aliceServer.Start(ctx); err != nil {
-			logger.Printf("Alice server error: %v", err)
-		}
-	}()
+	// Reload edited prompt files
+	if prompts != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			prompts.Watch(ctx, time.Duration(cfg.PromptPollMs)*time.Millisecond)
+		}()
+	}
 
+	// Delete old audio files
+	if speech != nil && cfg.AudioMaxAgeSec > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			speech.Prune(ctx, time.Duration(cfg.AudioMaxAgeSec)*time.Second)
+		}()
+	}
+
+	// Start HTTP server
+	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := bobServer.Start(ctx); err != nil {
-			logger.Printf("Bob server error: %v", err)
+		if err := httpServer.Start(ctx); err != nil {
+			logger.Printf("HTTP server error: %v", err)
 		}
 	}()
 
@@ -107,3 +204,171 @@ func main() {
 	wg.Wait()
 	logger.Println("AI Server stopped")
 }
+
+// newRegistry creates the configured personas. Personas without a prompt file
+// use the built-in prompt of the same name.
+func newRegistry(cfg *config.Config) (*persona.Registry, error) {
+	builtin := ai.DefaultPrompts()
+	var personas []*persona.Persona
+	for name, pc := range cfg.Personas {
+		text, ok := builtin[name]
+		if pc.PromptFile != "" {
+			data, err := os.ReadFile(pc.PromptFile)
+			if err != nil {
+				return nil, fmt.Errorf("persona %s: %w", name, err)
+			}
+			text, ok = string(data), true
+		}
+		if !ok {
+			return nil, fmt.Errorf("persona %s: no prompt_file", name)
+		}
+
+		personas = append(personas, &persona.Persona{
+			Name:        name,
+			DisplayName: pc.DisplayName,
+			Root:        pc.Root,
+			Role:        persona.Role(pc.Role),
+			Prompt:      text,
+			Provider:    pc.Provider,
+			Settings:    settings(pc),
+			Timeout:     time.Duration(pc.TimeoutSec) * time.Second,
+			Voice:       pc.Voice,
+		})
+	}
+	return persona.NewRegistry(personas)
+}
+
+// backendFactory returns a factory that creates the LLM backend for a persona,
+// retrying failed queries according to the config
+func backendFactory(cfg *config.Config, personas *persona.Registry) (session.BackendFactory, error) {
+	// the provider backends are stateless, so all sessions share one per
+	// persona, and personas with the same provider share its client
+	clients := map[string]*llm.ClientBackend{}
+	shared := map[string]llm.Backend{}
+	scripts := map[string][]string{}
+	for _, p := range personas.All() {
+		if p.Provider != "fake" {
+			client, ok := clients[p.Provider]
+			if !ok {
+				client = llm.NewClientBackend(p.Provider)
+				clients[p.Provider] = client
+			}
+			shared[p.Name] = llm.NewRetryBackend(client, retryPolicy(cfg, p))
+			continue
+		}
+
+		// load the fake scripts once, each session gets its own fake backends
+		path := cfg.Personas[p.Name].FakeScript
+		if path == "" {
+			continue
+		}
+		script, err := llm.LoadScript(path)
+		if err != nil {
+			return nil, err
+		}
+		scripts[p.Name] = script
+	}
+	delay := time.Duration(cfg.FakeDelayMs) * time.Millisecond
+
+	return func(p *persona.Persona) (llm.Backend, error) {
+		if backend, ok := shared[p.Name]; ok {
+			return backend, nil
+		}
+		fake := llm.NewFakeBackend(p.Root, scripts[p.Name], delay)
+		return llm.NewRetryBackend(fake, retryPolicy(cfg, p)), nil
+	}, nil
+}
+
+// retryPolicy returns the retry policy of a persona's queries
+func retryPolicy(cfg *config.Config, p *persona.Persona) llm.RetryPolicy {
+	return llm.RetryPolicy{
+		MaxAttempts:    cfg.LLMMaxAttempts,
+		BaseDelay:      time.Duration(cfg.LLMRetryBaseMs) * time.Millisecond,
+		MaxDelay:       time.Duration(cfg.LLMRetryMaxMs) * time.Millisecond,
+		FallbackModels: cfg.LLMFallbackModels,
+		Timeout:        p.Timeout,
+	}
+}
+
+// settings returns the model and generation options of a persona
+func settings(pc config.PersonaConfig) llm.Settings {
+	return llm.Settings{
+		Model:       pc.Model,
+		Temperature: float32(pc.Temperature),
+		MaxTokens:   int64(pc.MaxTokens),
+	}
+}
+
+// tokenCounter returns the counter of a tiktoken encoding, or an estimate if
+// the encoding is "estimate" or cannot be loaded
+func tokenCounter(encoding string) window.Counter {
+	if encoding == "estimate" {
+		return window.Estimate{}
+	}
+	counter, err := window.NewTiktoken(encoding)
+	if err != nil {
+		logger.Printf("Failed to load token encoding %s, estimating token counts: %v", encoding, err)
+		return window.Estimate{}
+	}
+	return counter
+}
+
+// promptPersonas returns the personas whose prompts a prompt store serves
+func promptPersonas(personas *persona.Registry) []prompt.Persona {
+	var ps []prompt.Persona
+	for _, p := range personas.All() {
+		ps = append(ps, prompt.Persona{Name: p.Name, Root: p.Root, Fallback: p.Prompt})
+	}
+	return ps
+}
+
+// promptSource returns the prompt store as an ai.PromptSource, nil if there is
+// none so the personas use their own prompts
+func promptSource(prompts *prompt.Store) ai.PromptSource {
+	if prompts == nil {
+		return nil
+	}
+	return prompts
+}
+
+// speaker returns the TTS pipeline as an ai.Speaker, nil if there is none so
+// the turns are not voiced
+func speaker(speech *tts.Pipeline) ai.Speaker {
+	if speech == nil {
+		return nil
+	}
+	return speech
+}
+
+// newSpeech creates the TTS pipeline selected by the config, nil for "none".
+// Personas without a voice get the engine's voice for their role.
+func newSpeech(cfg *config.Config, personas *persona.Registry) (*tts.Pipeline, error) {
+	var synth tts.Synthesizer
+	var roleVoices map[persona.Role]string
+	switch cfg.TTSEngine {
+	case "none", "":
+		return nil, nil
+	case "tone":
+		synth = tts.ToneSynthesizer{}
+		roleVoices = map[persona.Role]string{persona.Answerer: "330", persona.Asker: "220"}
+	case "espeak":
+		synth = tts.EspeakSynthesizer{Path: cfg.EspeakPath}
+		roleVoices = map[persona.Role]string{persona.Answerer: "en+f3", persona.Asker: "en+m3"}
+	default:
+		return nil, fmt.Errorf("unknown TTS engine %q", cfg.TTSEngine)
+	}
+
+	voices := map[string]string{}
+	for _, p := range personas.All() {
+		voices[p.Name] = p.Voice
+		if p.Voice == "" {
+			voices[p.Name] = roleVoices[p.Role]
+		}
+	}
+	pipeline, err := tts.NewPipeline(synth, cfg.AudioDir, "/audio/", voices)
+	if err != nil {
+		return nil, err
+	}
+	logger.Printf("Speaking turns with %s, audio in %s", cfg.TTSEngine, cfg.AudioDir)
+	return pipeline, nil
+}
@@ -1,24 +1,266 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 )
 
+// PersonaConfig defines a persona: its character, role and the LLM provider,
+// model and generation options it runs on
+type PersonaConfig struct {
+	DisplayName string `json:"display_name"` // shown to users, "" for the capitalized name
+	Root        string `json:"root"`         // XML root tag of its replies, "" for the name
+	Role        string `json:"role"`         // "asker" or "answerer"
+	PromptFile  string `json:"prompt_file"`  // system prompt, "" for the built-in one of alice and bob
+	Voice       string `json:"voice"`        // TTS voice, "" for the engine default
+	FakeScript  string `json:"fake_script"`  // replies of the fake provider
+
+	Provider    string  `json:"provider"`    // provider name (e.g. "gemini") or "fake"
+	Model       string  `json:"model"`       // e.g. "gemini-2.5-pro"
+	Temperature float64 `json:"temperature"` // 0 to 1, scaled to the provider's range
+	MaxTokens   int     `json:"max_tokens"`  // response limit, 0 for the model's maximum
+	TimeoutSec  int     `json:"timeout_sec"` // limit of each query attempt, 0 for none
+}
+
 // Config holds application configuration
 type Config struct {
-	AlicePort     int
-	BobPort       int
+	// Host and Port of the single HTTP server for WebSockets, transcripts and health checks
+	Host          string
+	Port          int
 	ChannelBuffer int
+
+	// What a full channel does with a message, as "channel=policy" settings
+	// (see internal/delivery), and how long the block policy waits for room,
+	// 0 to wait until the send is cancelled: by the end of its turn for the
+	// AIs' sends, or by the session closing for client messages to an AI
+	ChannelPolicies  []string
+	ChannelTimeoutMs int
+
+	// Directories of the built web clients served at /alice/ and /bob/, "" to not serve them
+	AliceStaticDir string
+	BobStaticDir   string
+
+	// ClientQueueSize is the number of messages buffered per WebSocket client;
+	// clients that fall further behind are disconnected
+	ClientQueueSize int
+
+	// TranscriptDir is where conversation transcripts are stored, "" disables them
+	TranscriptDir    string
+	ReplayIntervalMs int
+
+	// TTSEngine voices each turn: "none", "tone" (offline sine tones) or
+	// "espeak" (a local espeak-ng binary at EspeakPath). The WAV files are
+	// written to AudioDir, served at /audio/ and deleted after AudioMaxAgeSec,
+	// 0 to keep them.
+	TTSEngine      string
+	AudioDir       string
+	AudioMaxAgeSec int
+	EspeakPath     string
+
+	// PromptDir holds <persona>-system.md files to use instead of the
+	// personas' prompts, "" to use their own. Edited files are picked up
+	// within PromptPollMs.
+	PromptDir    string
+	PromptPollMs int
+
+	// Per-conversation limits, 0 means unlimited
+	MaxTurns       int
+	MaxDurationSec int
+	MaxTokens      int
+
+	// ContextStrategy keeps each persona's system prompt and history within
+	// ContextMaxTokens: "none", "sliding_window", "first_recent" or "summary".
+	// Tokens are estimated by default, or counted with the TokenEncoding
+	// tiktoken encoding, e.g. "cl100k_base", falling back to the estimate if
+	// it cannot be loaded.
+	ContextStrategy  string
+	ContextMaxTokens int
+	TokenEncoding    string
+
+	// Conversations with no connected clients for SessionIdleTimeoutSec are closed
+	SessionIdleTimeoutSec int
+	MaxSessions           int
+
+	// LLMBackend is the default provider of the personas: "gemini",
+	// "anthropic", "openai" or "fake" for the offline scripted backend
+	LLMBackend  string
+	FakeDelayMs int
+
+	// Failed LLM queries are retried up to LLMMaxAttempts times per model with
+	// exponential backoff, then retried with each of LLMFallbackModels
+	LLMMaxAttempts    int
+	LLMRetryBaseMs    int
+	LLMRetryMaxMs     int
+	LLMFallbackModels []string
+
+	// Personas by name: the built-in alice and bob plus those defined in the
+	// CONFIG_FILE JSON file, overridden by <NAME>_* environment variables.
+	// Conversations are held between DefaultAsker and DefaultAnswerer unless
+	// their clients ask for other personas.
+	Personas        map[string]PersonaConfig
+	DefaultAsker    string
+	DefaultAnswerer string
+
+	// RoundTableStrategy is the turn-taking at round tables whose clients do
+	// not choose one: "round_robin", "operator" or "llm"
+	RoundTableStrategy string
+
+	// HumanTimeoutSec is how long a person playing a persona has to reply
+	// before the model replies for them, 0 to wait indefinitely
+	HumanTimeoutSec int
 }
 
-// Load returns a new Config with values from environment or defaults
-func Load() *Config {
-	return &Config{
-		AlicePort:     getEnvInt("ALICE_PORT", 8003),
-		BobPort:       getEnvInt("BOB_PORT", 8004),
+// defaultPersona is the persona config before the config file and environment
+// are applied
+var defaultPersona = PersonaConfig{
+	Model:      "gemini-2.5-pro",
+	TimeoutSec: 120,
+}
+
+// Load returns a new Config with values from environment or defaults. Personas
+// are read from the CONFIG_FILE JSON file, if any, and then overridden by the
+// environment.
+func Load() (*Config, error) {
+	cfg := &Config{
+		Host:          getEnv("HOST", "localhost"),
+		Port:          getEnvInt("PORT", 8000),
 		ChannelBuffer: getEnvInt("CHANNEL_BUFFER", 10),
+
+		ChannelPolicies:  getEnvList("CHANNEL_POLICIES"),
+		ChannelTimeoutMs: getEnvInt("CHANNEL_TIMEOUT_MS", 5000),
+
+		AliceStaticDir: getEnv("ALICE_STATIC_DIR", ""),
+		BobStaticDir:   getEnv("BOB_STATIC_DIR", ""),
+
+		ClientQueueSize: getEnvInt("CLIENT_QUEUE_SIZE", 32),
+
+		TranscriptDir:    getEnv("TRANSCRIPT_DIR", "transcripts"),
+		ReplayIntervalMs: getEnvInt("REPLAY_INTERVAL_MS", 3000),
+
+		TTSEngine:      getEnv("TTS_ENGINE", "none"),
+		AudioDir:       getEnv("AUDIO_DIR", "audio"),
+		AudioMaxAgeSec: getEnvInt("AUDIO_MAX_AGE_SEC", 3600),
+		EspeakPath:     getEnv("ESPEAK_PATH", "espeak-ng"),
+
+		PromptDir:    getEnv("PROMPT_DIR", ""),
+		PromptPollMs: getEnvInt("PROMPT_POLL_MS", 2000),
+
+		MaxTurns:       getEnvInt("MAX_TURNS", 20),
+		MaxDurationSec: getEnvInt("MAX_DURATION_SEC", 600),
+		MaxTokens:      getEnvInt("MAX_TOKENS", 0),
+
+		ContextStrategy:  getEnv("CONTEXT_STRATEGY", "first_recent"),
+		ContextMaxTokens: getEnvInt("CONTEXT_MAX_TOKENS", 32000),
+		TokenEncoding:    getEnv("TOKEN_ENCODING", "estimate"),
+
+		SessionIdleTimeoutSec: getEnvInt("SESSION_IDLE_TIMEOUT_SEC", 600),
+		MaxSessions:           getEnvInt("MAX_SESSIONS", 100),
+
+		LLMBackend:  getEnv("LLM_BACKEND", "gemini"),
+		FakeDelayMs: getEnvInt("FAKE_DELAY_MS", 1000),
+
+		LLMMaxAttempts:    getEnvInt("LLM_MAX_ATTEMPTS", 3),
+		LLMRetryBaseMs:    getEnvInt("LLM_RETRY_BASE_MS", 1000),
+		LLMRetryMaxMs:     getEnvInt("LLM_RETRY_MAX_MS", 30000),
+		LLMFallbackModels: getEnvList("LLM_FALLBACK_MODELS"),
+
+		DefaultAsker:    getEnv("DEFAULT_ASKER", "bob"),
+		DefaultAnswerer: getEnv("DEFAULT_ANSWERER", "alice"),
+
+		RoundTableStrategy: getEnv("ROUNDTABLE_STRATEGY", "round_robin"),
+
+		HumanTimeoutSec: getEnvInt("HUMAN_TIMEOUT_SEC", 120),
 	}
+
+	cfg.Personas = map[string]PersonaConfig{
+		"alice": cfg.newPersona("answerer"),
+		"bob":   cfg.newPersona("asker"),
+	}
+
+	if path := getEnv("CONFIG_FILE", ""); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+	for name, p := range cfg.Personas {
+		cfg.Personas[name] = personaFromEnv(name, p)
+	}
+
+	return cfg, nil
+}
+
+// newPersona returns the config of a persona before the config file and
+// environment are applied
+func (c *Config) newPersona(role string) PersonaConfig {
+	p := defaultPersona
+	p.Role = role
+	p.Provider = c.LLMBackend
+	return p
+}
+
+// loadFile applies the persona sections of a JSON config file, keyed by
+// persona name, e.g.
+//
+//	{"alice": {"model": "gemini-2.5-pro", "temperature": 0.7},
+//	 "expert": {"role": "answerer", "prompt_file": "prompts/expert.md"}}
+//
+// Fields missing from the file keep their current values, or the defaults for
+// a new persona. Prompt and script paths are relative to the file.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(data, &sections); err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	for name, section := range sections {
+		p, ok := c.Personas[name]
+		if !ok {
+			p = c.newPersona("")
+		}
+		decoder := json.NewDecoder(bytes.NewReader(section))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&p); err != nil {
+			return fmt.Errorf("persona %s: %w", name, err)
+		}
+		p.PromptFile = resolve(dir, p.PromptFile)
+		p.FakeScript = resolve(dir, p.FakeScript)
+		c.Personas[name] = p
+	}
+	return nil
+}
+
+// resolve returns path relative to dir, unless it is empty or absolute
+func resolve(dir string, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// personaFromEnv overrides a persona config with the environment variables
+// <NAME>_PROVIDER, _MODEL, _TEMPERATURE, _MAX_TOKENS, _TIMEOUT_SEC, _VOICE
+// and FAKE_<NAME>_SCRIPT, where NAME is the upper case persona name with
+// dashes replaced by underscores
+func personaFromEnv(name string, p PersonaConfig) PersonaConfig {
+	prefix := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	p.Provider = getEnv(prefix+"_PROVIDER", p.Provider)
+	p.Model = getEnv(prefix+"_MODEL", p.Model)
+	p.Temperature = getEnvFloat(prefix+"_TEMPERATURE", p.Temperature)
+	p.MaxTokens = getEnvInt(prefix+"_MAX_TOKENS", p.MaxTokens)
+	p.TimeoutSec = getEnvInt(prefix+"_TIMEOUT_SEC", p.TimeoutSec)
+	p.Voice = getEnv(prefix+"_VOICE", p.Voice)
+	p.FakeScript = getEnv("FAKE_"+prefix+"_SCRIPT", p.FakeScript)
+	return p
 }
 
 // getEnv returns the value of an environment variable or a default value
@@ -29,6 +271,17 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvList returns the comma-separated values of an environment variable
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 // getEnvInt returns the integer value of an environment variable or a default value
 func getEnvInt(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
@@ -38,3 +291,13 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// getEnvFloat returns the float value of an environment variable or a default value
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
@@ -3,8 +3,9 @@ module github.com/dmh2000/ai-server
 go 1.25.3
 
 require (
-	github.com/dmh2000/go-llmclient v1.0.0
 	github.com/gorilla/websocket v1.5.3
+	github.com/pkoukk/tiktoken-go v0.1.7
+	github.com/tmc/langchaingo v0.1.13
 )
 
 require (
@@ -26,8 +27,6 @@ require (
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/googleapis/enterprise-certificate-proxy v0.3.6 // indirect
 	github.com/googleapis/gax-go/v2 v2.15.0 // indirect
-	github.com/pkoukk/tiktoken-go v0.1.7 // indirect
-	github.com/tmc/langchaingo v0.1.13 // indirect
 	go.opentelemetry.io/auto/sdk v1.1.0 // indirect
 	go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc v0.63.0 // indirect
 	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.63.0 // indirect
@@ -47,5 +46,4 @@ require (
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250826171959-ef028d996bc1 // indirect
 	google.golang.org/grpc v1.75.0 // indirect
 	google.golang.org/protobuf v1.36.8 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
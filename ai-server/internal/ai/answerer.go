@@ -0,0 +1,269 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/delivery"
+	"github.com/dmh2000/ai-server/internal/llm"
+	"github.com/dmh2000/ai-server/internal/logger"
+	"github.com/dmh2000/ai-server/internal/parser"
+	"github.com/dmh2000/ai-server/internal/persona"
+	"github.com/dmh2000/ai-server/internal/types"
+)
+
+// answererFallback is the reply used when the answerer's output cannot be parsed
+const answererFallback = "Hmm, can you repeat the question?"
+
+// Answerer plays a persona that answers questions, Alice by default
+type Answerer struct {
+	component
+	persona   *persona.Persona
+	fromUI    <-chan types.ConversationMessage
+	fromAsker <-chan types.ConversationMessage
+	toAsker   *delivery.Channel
+	context   turnHistory
+	notes     []string // operator notes for the next prompt
+	backend   llm.Backend
+	human     *humanPlayer // nil when the model plays the persona
+	messages  int          // number of responses, used for message IDs
+}
+
+// NewAnswerer creates an answering AI component playing the persona
+func NewAnswerer(
+	p *persona.Persona,
+	fromServer <-chan types.ConversationMessage,
+	toServer *delivery.Channel,
+	fromAsker <-chan types.ConversationMessage,
+	toAsker *delivery.Channel,
+	backend llm.Backend,
+) *Answerer {
+	return &Answerer{
+		component: newComponent(p.DisplayName, toServer),
+		persona:   p,
+		fromUI:    fromServer,
+		fromAsker: fromAsker,
+		toAsker:   toAsker,
+		backend:   backend,
+	}
+}
+
+// Reset clears the conversation context and pauses processing
+func (a *Answerer) Reset() {
+	a.pauseMutex.Lock()
+	a.paused = true
+	a.notes = nil
+	a.pauseMutex.Unlock()
+	a.context.clear()
+	a.human.take()
+	logger.Printf("%s AI context reset and paused", a.persona.DisplayName)
+}
+
+// Resume allows the AI to process messages again
+func (a *Answerer) Resume() {
+	a.pauseMutex.Lock()
+	a.paused = false
+	a.pauseMutex.Unlock()
+	logger.Printf("%s AI resumed", a.persona.DisplayName)
+}
+
+// SetHuman lets a person play the persona through its web client. The model
+// answers for them if they have not replied within timeout (0 to wait
+// indefinitely).
+func (a *Answerer) SetHuman(timeout time.Duration) {
+	a.human = newHumanPlayer(timeout)
+}
+
+// Start begins processing messages. Answers are generated by the worker, so
+// the loop keeps handling client messages while a model query is outstanding.
+func (a *Answerer) Start(ctx context.Context) {
+	name := a.persona.DisplayName
+	logger.Printf("%s AI started", name)
+	defer a.worker.wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Printf("%s AI shutting down", name)
+			return
+
+		case msg := <-a.fromUI:
+			if a.Turns.Stale(msg) {
+				logger.Printf("%s AI dropping a client message from before the last reset", name)
+				continue
+			}
+			// Operator notes are kept for the next answer
+			if msg.Type == types.MessageTypeInject {
+				a.pauseMutex.Lock()
+				a.notes = append(a.notes, msg.Text)
+				a.pauseMutex.Unlock()
+				logger.Printf("%s AI received operator note for its next answer: %s", name, msg.Text)
+				continue
+			}
+			// A person playing the answerer replies to the question
+			if a.human.take() {
+				logger.Printf("%s AI received the answer of the person playing it", name)
+				turn, text := a.Turns.Context(), msg.Text
+				a.worker.run(func() error { return a.answer(turn, text) })
+				continue
+			}
+			// Other messages from the answerer's clients are out of turn
+			logger.Printf("%s AI received from server out of turn: %s", name, msg.Text)
+
+		case <-a.human.expired():
+			if a.human.take() {
+				logger.Printf("%s AI received no answer from the person playing it, the model answers instead", name)
+				turn := a.Turns.Context()
+				a.worker.run(func() error { return a.answer(turn, "") })
+			}
+
+		case question := <-accept(a.worker, a.fromAsker):
+			// Check if paused or from before a reset - if so, discard message
+			if a.Turns.Stale(question) {
+				logger.Printf("%s AI dropping a question from before the last reset", name)
+				continue
+			}
+			if a.isPaused() {
+				logger.Printf("%s AI is paused, discarding question", name)
+				continue
+			}
+			// Handle questions from the asker
+			logger.Printf("%s AI received question", name)
+			turn := a.Turns.Context()
+			a.worker.run(func() error { return a.processQuestion(turn, question) })
+
+		case err := <-a.worker.results:
+			a.finish(err)
+		}
+	}
+}
+
+// processQuestion generates a response and sends it to both server and asker.
+// The turn runs under ctx, which is cancelled if the conversation is reset.
+func (a *Answerer) processQuestion(ctx context.Context, msg types.ConversationMessage) error {
+	// Hold the turn while the operator has paused the conversation
+	if !a.Gate.Wait(ctx) {
+		logger.Printf("%s AI was reset while paused, discarding question", a.persona.DisplayName)
+		return nil
+	}
+	if a.isPaused() {
+		logger.Printf("%s AI was reset while paused, discarding question", a.persona.DisplayName)
+		return nil
+	}
+
+	// Stop instead of answering once the conversation budget is used up
+	if a.exhausted() {
+		return nil
+	}
+
+	// add the question and any operator notes to context
+	logger.Printf("---> question: %s", msg.Text)
+	a.pauseMutex.Lock()
+	notes := a.notes
+	a.notes = nil
+	a.pauseMutex.Unlock()
+	entries := append([]llm.Message{message(a.persona.Name, msg.Speaker, msg.Text)}, operatorNotes(a.persona.Name, notes)...)
+	if !a.context.add(ctx, entries...) {
+		logger.Printf("%s AI turn was cancelled, discarding the question", a.persona.DisplayName)
+		return nil
+	}
+
+	// A person playing the answerer is shown the question and replies from the UI
+	if a.human != nil {
+		a.human.wait()
+		a.send(ctx, types.ConversationMessage{Type: types.MessageTypeHumanTurn, Text: displayText(msg.Text)})
+		return nil
+	}
+	return a.answer(ctx, "")
+}
+
+// answer generates a response to the question at the end of the context, or
+// uses written, a response written by a person, and sends it to both server
+// and asker
+func (a *Answerer) answer(ctx context.Context, written string) error {
+	response, reply, err := a.createResponseMessage(ctx, written)
+	if discarded(ctx, a.persona.DisplayName, "the answer") {
+		return nil
+	}
+	if err != nil {
+		logger.Printf("Error creating response: %v", err)
+		return &turnError{persona: a.persona.Name, err: err}
+	}
+
+	logger.Printf("%s AI responding", a.persona.DisplayName)
+
+	// ===============================
+	// create UI response
+	// ===============================
+	text := reply.Text
+	if reply.IsError() {
+		logger.Printf("%s AI asked for clarification: %s", a.persona.DisplayName, text)
+	}
+
+	responseToUI := stamp(ctx, types.ConversationMessage{
+		Type:  types.MessageTypeFinal,
+		ID:    response.ID,
+		Text:  text,
+		Audio: a.speak(ctx, a.persona, text),
+	})
+	if discarded(ctx, a.persona.DisplayName, "the answer") {
+		return nil
+	}
+	a.record(a.persona.Name, response.Text, text)
+
+	// Send to server for display
+	if err := a.toUI.Send(ctx, responseToUI); err == nil {
+		logger.Printf("%s AI sent response to server", a.persona.DisplayName)
+	}
+
+	// Send text to the asker for context
+	if err := a.toAsker.Send(ctx, response); err == nil {
+		logger.Printf("%s AI sent response to the asker", a.persona.DisplayName)
+	}
+
+	return nil
+}
+
+func (a *Answerer) createResponseMessage(ctx context.Context, written string) (types.ConversationMessage, *parser.Result, error) {
+	a.messages++
+	stream := newDeltaStream(ctx, fmt.Sprintf("%s-%d", a.persona.Name, a.messages), a.toUI)
+
+	var reply *parser.Result
+	if written != "" {
+		reply = &parser.Result{Root: a.persona.Root, Text: written}
+	} else {
+		// issue query, streaming the answer to the UI as it is generated
+		system := a.prompt(a.persona)
+		a.context.trim(ctx, a.trimmer, a.persona.DisplayName, system)
+		history := a.context.get()
+		settings := a.persona.Settings
+		output, err := a.queryStream(ctx, a.persona.Name, a.backend, system, history, settings, stream.onChunk)
+		if err == nil {
+			// a reply that arrives after its turn was cancelled belongs to no conversation
+			err = ctx.Err()
+		}
+		if err != nil {
+			logger.Printf("Error querying LLM: %v", err)
+			return types.ConversationMessage{}, nil, err
+		}
+		logger.Printf("<--- %s: %s", a.persona.Name, output)
+
+		reply = a.parse(a.persona, output, answererFallback)
+	}
+	answer := reply.XML()
+
+	// add the answer to context, unless the turn was cancelled meanwhile
+	if !a.context.add(ctx, message(a.persona.Name, a.persona.Name, answer)) {
+		return types.ConversationMessage{}, nil, ctx.Err()
+	}
+
+	// create AI response
+	aiMsg := stamp(ctx, types.ConversationMessage{
+		ID:      stream.id,
+		Text:    answer,
+		Speaker: a.persona.Name,
+	})
+
+	return aiMsg, reply, nil
+}
@@ -0,0 +1,349 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/delivery"
+	"github.com/dmh2000/ai-server/internal/llm"
+	"github.com/dmh2000/ai-server/internal/logger"
+	"github.com/dmh2000/ai-server/internal/parser"
+	"github.com/dmh2000/ai-server/internal/persona"
+	"github.com/dmh2000/ai-server/internal/types"
+)
+
+// askerFallback is the question used when the asker's output cannot be parsed
+const askerFallback = "Oops, I lost my train of thought. Where was I?"
+
+// Asker plays a persona that takes the operator's question and asks
+// follow-up questions, Bob by default
+type Asker struct {
+	component
+	persona        *persona.Persona
+	fromUI         <-chan types.ConversationMessage
+	toAnswerer     *delivery.Channel
+	fromAnswerer   <-chan types.ConversationMessage
+	context        turnHistory
+	notes          []string // operator notes for the next prompt
+	override       string   // operator's replacement for the next question
+	backend        llm.Backend
+	human          *humanPlayer // nil when the model plays the persona
+	messages       int          // number of follow-up questions, used for message IDs
+	onStartNewConv func()       // callback when new conversation starts
+}
+
+// NewAsker creates an asking AI component playing the persona
+func NewAsker(
+	p *persona.Persona,
+	fromServer <-chan types.ConversationMessage,
+	toServer *delivery.Channel,
+	toAnswerer *delivery.Channel,
+	fromAnswerer <-chan types.ConversationMessage,
+	backend llm.Backend,
+) *Asker {
+	return &Asker{
+		component:    newComponent(p.DisplayName, toServer),
+		persona:      p,
+		fromUI:       fromServer,
+		toAnswerer:   toAnswerer,
+		fromAnswerer: fromAnswerer,
+		backend:      backend,
+	}
+}
+
+// Reset clears the conversation context and pauses processing
+func (q *Asker) Reset() {
+	q.pauseMutex.Lock()
+	q.paused = true
+	q.notes = nil
+	q.override = ""
+	q.pauseMutex.Unlock()
+	q.context.clear()
+	q.human.take()
+	logger.Printf("%s AI context reset and paused", q.persona.DisplayName)
+}
+
+// Resume allows the AI to process messages again
+func (q *Asker) Resume() {
+	q.pauseMutex.Lock()
+	q.paused = false
+	q.pauseMutex.Unlock()
+	logger.Printf("%s AI resumed", q.persona.DisplayName)
+}
+
+// SetHuman lets a person play the persona through its web client. The model
+// asks the follow-up questions for them if they have not written one within
+// timeout (0 to wait indefinitely).
+func (q *Asker) SetHuman(timeout time.Duration) {
+	q.human = newHumanPlayer(timeout)
+}
+
+// SetStartNewConvCallback sets the callback for when a new conversation starts
+func (q *Asker) SetStartNewConvCallback(fn func()) {
+	q.onStartNewConv = fn
+}
+
+// Start begins processing messages. Questions are generated by the worker, so
+// the loop keeps handling operator messages while a model query is outstanding.
+func (q *Asker) Start(ctx context.Context) {
+	name := q.persona.DisplayName
+	logger.Printf("%s AI started", name)
+	defer q.worker.wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Printf("%s AI shutting down", name)
+			return
+
+		case msg := <-q.fromUI:
+			if q.Turns.Stale(msg) {
+				logger.Printf("%s AI dropping a client message from before the last reset", name)
+				continue
+			}
+			// Operator messages steer the running conversation
+			if types.IsOperatorMessage(msg.Type) {
+				q.processOperatorMessage(msg)
+				continue
+			}
+
+			// A person playing the asker writes the follow-up question
+			if q.human.take() {
+				logger.Printf("%s AI received the question of the person playing it", name)
+				turn, text := q.Turns.Context(), msg.Text
+				q.worker.run(func() error { return q.askFollowUp(turn, text) })
+				continue
+			}
+
+			// New message from UI - resume processing and notify the answerer,
+			// after any turn of the previous conversation still running. A
+			// reset while it waits drops it, so it starts no conversation.
+			turn, text := q.Turns.Context(), msg.Text
+			q.worker.run(func() error {
+				if discarded(turn, name, "the initial message") {
+					return nil
+				}
+				q.Resume()
+				if q.onStartNewConv != nil {
+					q.onStartNewConv()
+				}
+				logger.Printf("%s AI processing initial message", name)
+				q.processInitialMessage(turn, text)
+				return nil
+			})
+
+		case msg := <-accept(q.worker, q.fromAnswerer):
+			// Check if paused or from before a reset - if so, discard message
+			if q.Turns.Stale(msg) {
+				logger.Printf("%s AI dropping an answer from before the last reset", name)
+				continue
+			}
+			if q.isPaused() {
+				logger.Printf("%s AI is paused, discarding answer", name)
+				continue
+			}
+			// Handle the answer from the answerer
+			logger.Printf("%s AI received answer", name)
+			turn := q.Turns.Context()
+			q.worker.run(func() error { return q.processResponse(turn, msg) })
+
+		case <-q.human.expired():
+			if q.human.take() {
+				logger.Printf("%s AI received no question from the person playing it, the model asks instead", name)
+				turn := q.Turns.Context()
+				q.worker.run(func() error { return q.askFollowUp(turn, "") })
+			}
+
+		case err := <-q.worker.results:
+			q.finish(err)
+		}
+	}
+}
+
+// processInitialMessage handles initial input and forwards it as a question
+func (q *Asker) processInitialMessage(ctx context.Context, input string) {
+	// Send acknowledgment to the asker's clients
+	initialMessage := stamp(ctx, types.ConversationMessage{
+		Text: input,
+	})
+
+	logger.Printf("%s initial message: %v", q.persona.DisplayName, initialMessage)
+
+	if err := q.toUI.Send(ctx, initialMessage); err == nil {
+		logger.Printf("%s AI sent acknowledgment to server", q.persona.DisplayName)
+	}
+
+	// Generate a question for the answerer
+	question := (&parser.Result{Root: q.persona.Root, Text: input}).XML()
+
+	// add the operator's question and the asker's forwarded copy to its context
+	operator := (&parser.Result{Root: persona.ModeratorName, Text: input}).XML()
+	if !q.context.add(ctx,
+		message(q.persona.Name, persona.ModeratorName, operator),
+		message(q.persona.Name, q.persona.Name, question)) {
+		logger.Printf("%s AI turn was cancelled, discarding the initial message", q.persona.DisplayName)
+		return
+	}
+	q.record(q.persona.Name, question, input)
+
+	questionMsg := stamp(ctx, types.ConversationMessage{
+		Text:    question,
+		Speaker: q.persona.Name,
+	})
+
+	if err := q.toAnswerer.Send(ctx, questionMsg); err == nil {
+		logger.Printf("%s AI sent question", q.persona.DisplayName)
+	}
+}
+
+// processOperatorMessage keeps an operator message for the asker's next
+// question. The context is kept, so the conversation carries on from there.
+func (q *Asker) processOperatorMessage(msg types.ConversationMessage) {
+	q.pauseMutex.Lock()
+	defer q.pauseMutex.Unlock()
+
+	switch msg.Type {
+	case types.MessageTypeInject:
+		q.notes = append(q.notes, msg.Text)
+	case types.MessageTypeTopic:
+		q.notes = append(q.notes, topicNote(msg.Text))
+	case types.MessageTypeOverride:
+		q.override = msg.Text
+	}
+	logger.Printf("%s AI received operator %s for its next question: %s", q.persona.DisplayName, msg.Type, msg.Text)
+}
+
+// takeOperatorMessages returns and clears the pending operator notes and override
+func (q *Asker) takeOperatorMessages() ([]string, string) {
+	q.pauseMutex.Lock()
+	defer q.pauseMutex.Unlock()
+	notes, override := q.notes, q.override
+	q.notes = nil
+	q.override = ""
+	return notes, override
+}
+
+// processResponse handles the answer and may generate a follow-up. The turn
+// runs under ctx, which is cancelled if the conversation is reset.
+func (q *Asker) processResponse(ctx context.Context, answer types.ConversationMessage) error {
+	logger.Printf("%s AI processing the response", q.persona.DisplayName)
+
+	// Hold the turn while the operator has paused the conversation
+	if !q.Gate.Wait(ctx) {
+		logger.Printf("%s AI was reset while paused, discarding answer", q.persona.DisplayName)
+		return nil
+	}
+	if q.isPaused() {
+		logger.Printf("%s AI was reset while paused, discarding answer", q.persona.DisplayName)
+		return nil
+	}
+
+	// Stop instead of asking a follow-up once the conversation budget is used up
+	if q.exhausted() {
+		return nil
+	}
+
+	// add the answer and any operator notes to context
+	notes, override := q.takeOperatorMessages()
+	entries := append([]llm.Message{message(q.persona.Name, answer.Speaker, answer.Text)}, operatorNotes(q.persona.Name, notes)...)
+	if !q.context.add(ctx, entries...) {
+		logger.Printf("%s AI turn was cancelled, discarding the answer", q.persona.DisplayName)
+		return nil
+	}
+	logger.Printf("---> answer: %s", answer.Text)
+
+	// A person playing the asker is shown the answer and writes the follow-up
+	// from the UI, unless the operator already replaced it
+	if q.human != nil && override == "" {
+		q.human.wait()
+		q.send(ctx, types.ConversationMessage{Type: types.MessageTypeHumanTurn, Text: displayText(answer.Text)})
+		return nil
+	}
+	return q.askFollowUp(ctx, override)
+}
+
+// askFollowUp generates a follow-up question to the answer at the end of the
+// context, or asks written, a question written by the operator or a person
+// playing the asker, and sends it to the answerer
+func (q *Asker) askFollowUp(ctx context.Context, written string) error {
+	question, reply, err := q.createQuestion(ctx, written)
+	if discarded(ctx, q.persona.DisplayName, "the question") {
+		return nil
+	}
+	if err != nil {
+		logger.Printf("Error creating response: %v", err)
+		return &turnError{persona: q.persona.Name, err: err}
+	}
+
+	// No question to ask; wait for the operator instead of sending the answerer an error
+	if reply.IsError() {
+		logger.Printf("%s AI replied with an error, waiting for the operator: %s", q.persona.DisplayName, reply.Text)
+		return nil
+	}
+
+	if err := q.toAnswerer.Send(ctx, question); err == nil {
+		logger.Printf("%s AI sent follow-up question", q.persona.DisplayName)
+	}
+	return nil
+}
+
+func (q *Asker) createQuestion(ctx context.Context, written string) (types.ConversationMessage, *parser.Result, error) {
+	q.messages++
+	stream := newDeltaStream(ctx, fmt.Sprintf("%s-%d", q.persona.Name, q.messages), q.toUI)
+
+	var reply *parser.Result
+	if written != "" {
+		// the question was written for the asker, so there is nothing to generate
+		logger.Printf("%s AI asking a written question", q.persona.DisplayName)
+		reply = &parser.Result{Root: q.persona.Root, Text: written}
+	} else {
+		// issue query, streaming the question to the UI as it is generated
+		system := q.prompt(q.persona)
+		q.context.trim(ctx, q.trimmer, q.persona.DisplayName, system)
+		history := q.context.get()
+		settings := q.persona.Settings
+		output, err := q.queryStream(ctx, q.persona.Name, q.backend, system, history, settings, stream.onChunk)
+		if err == nil {
+			// a reply that arrives after its turn was cancelled belongs to no conversation
+			err = ctx.Err()
+		}
+		if err != nil {
+			logger.Printf("Error querying LLM: %v", err)
+			return types.ConversationMessage{}, nil, err
+		}
+
+		logger.Printf("<--- %s: %s", q.persona.Name, output)
+
+		// make sure the question the ai generated is in the proper xml format
+		reply = q.parse(q.persona, output, askerFallback)
+	}
+	question := reply.XML()
+
+	// create the UI msg
+	text := reply.Text
+
+	uiMsg := stamp(ctx, types.ConversationMessage{
+		Type:  types.MessageTypeFinal,
+		ID:    stream.id,
+		Text:  text,
+		Audio: q.speak(ctx, q.persona, text),
+	})
+	// add question to context, unless the turn was cancelled meanwhile
+	if !q.context.add(ctx, message(q.persona.Name, q.persona.Name, question)) {
+		return types.ConversationMessage{}, nil, ctx.Err()
+	}
+
+	questionMsg := stamp(ctx, types.ConversationMessage{
+		Text:    question,
+		Speaker: q.persona.Name,
+	})
+	q.record(q.persona.Name, questionMsg.Text, text)
+
+	// send to display
+	if err := q.toUI.Send(ctx, uiMsg); err == nil {
+		logger.Printf("%s AI sent question to server", q.persona.DisplayName)
+	}
+
+	return questionMsg, reply, nil
+}
@@ -0,0 +1,116 @@
+package ai
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/delivery"
+	"github.com/dmh2000/ai-server/internal/llm"
+	"github.com/dmh2000/ai-server/internal/persona"
+	"github.com/dmh2000/ai-server/internal/types"
+)
+
+// blockingBackend signals each query on started and blocks until the query is
+// cancelled
+type blockingBackend struct {
+	started chan struct{}
+}
+
+func (b *blockingBackend) QueryText(ctx context.Context, system string, history []llm.Message, model string, options llm.Options) (string, error) {
+	b.started <- struct{}{}
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+// receive returns the next message on ch, failing the test if none arrives
+func receive(t *testing.T, ch <-chan types.ConversationMessage) types.ConversationMessage {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message arrived")
+		return types.ConversationMessage{}
+	}
+}
+
+func TestResetDropsQueuedQuestion(t *testing.T) {
+	bob := &persona.Persona{Name: "bob", DisplayName: "Bob", Root: "bob", Role: persona.Asker}
+	fromUI := delivery.New(delivery.ServerToAI, 4, delivery.Options{})
+	toUI := delivery.New(delivery.AIToServer, 16, delivery.Options{})
+	toAnswerer := delivery.New(delivery.AskerToAnswerer, 4, delivery.Options{})
+	fromAnswerer := delivery.New(delivery.AnswererToAsker, 4, delivery.Options{})
+
+	// the follow-up question takes long enough to queue a question behind it
+	backend := &blockingBackend{started: make(chan struct{}, 1)}
+	q := NewAsker(bob, fromUI.Receive(), toUI, toAnswerer, fromAnswerer.Receive(), backend)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	turns := NewTurns(ctx, "test")
+	q.SetConversation(Conversation{Turns: turns})
+	var started atomic.Int32
+	q.SetStartNewConvCallback(func() { started.Add(1) })
+
+	done := make(chan struct{})
+	go func() {
+		q.Start(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	send := func(ch *delivery.Channel, msg types.ConversationMessage) {
+		t.Helper()
+		if err := ch.Send(context.Background(), turns.Stamp(msg)); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	// Q1 starts a conversation, and the answer to it starts the long follow-up
+	send(fromUI, types.ConversationMessage{Text: "Q1"})
+	if got := displayText(receive(t, toAnswerer.Receive()).Text); got != "Q1" {
+		t.Fatalf("asked %q, want Q1", got)
+	}
+	send(fromAnswerer, types.ConversationMessage{Text: "<alice>A1</alice>", Speaker: "alice"})
+	select {
+	case <-backend.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the follow-up question was not queried")
+	}
+
+	// Q2 waits behind the follow-up when the conversation is reset
+	send(fromUI, types.ConversationMessage{Text: "Q2"})
+	time.Sleep(20 * time.Millisecond)
+	turns.Advance()
+	q.Reset()
+
+	// Q3 of the new generation runs after Q2, which must have been dropped
+	send(fromUI, types.ConversationMessage{Text: "Q3"})
+	if got := displayText(receive(t, toAnswerer.Receive()).Text); got != "Q3" {
+		t.Errorf("asked %q after the reset, want Q3", got)
+	}
+	if n := started.Load(); n != 2 {
+		t.Errorf("%d conversations started, want 2: the question queued before the reset started one", n)
+	}
+
+	// nothing else reached the answerer
+	select {
+	case msg := <-toAnswerer.Receive():
+		t.Errorf("answerer received %q", msg.Text)
+	default:
+	}
+	var acknowledged []string
+	for len(toUI.Receive()) > 0 {
+		if msg := <-toUI.Receive(); msg.Type == "" {
+			acknowledged = append(acknowledged, msg.Text)
+		}
+	}
+	if !reflect.DeepEqual(acknowledged, []string{"Q1", "Q3"}) {
+		t.Errorf("acknowledged %q, want [Q1 Q3]", acknowledged)
+	}
+}
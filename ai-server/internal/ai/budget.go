@@ -0,0 +1,105 @@
+package ai
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/types"
+)
+
+// Limits bounds a single conversation. Zero values mean unlimited.
+type Limits struct {
+	MaxTurns    int           // LLM generations (answers and follow-up questions)
+	MaxDuration time.Duration // time since the operator's initial question
+	MaxTokens   int           // prompt and response tokens
+}
+
+// Budget tracks how much of its Limits a conversation has used.
+// One Budget is shared by both personas of a conversation.
+type Budget struct {
+	limits  Limits
+	mutex   sync.Mutex
+	turns   int
+	tokens  int
+	started time.Time
+	ended   bool
+}
+
+// NewBudget creates a budget with the given limits
+func NewBudget(limits Limits) *Budget {
+	return &Budget{
+		limits:  limits,
+		started: time.Now(),
+	}
+}
+
+// Restart clears the usage for a new conversation
+func (b *Budget) Restart() {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	b.turns = 0
+	b.tokens = 0
+	b.started = time.Now()
+	b.ended = false
+	b.mutex.Unlock()
+}
+
+// Check returns the reason the conversation must stop, or "" if another turn is allowed
+func (b *Budget) Check() string {
+	if b == nil {
+		return ""
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch {
+	case b.limits.MaxTurns > 0 && b.turns >= b.limits.MaxTurns:
+		return types.EndReasonMaxTurns
+	case b.limits.MaxDuration > 0 && time.Since(b.started) >= b.limits.MaxDuration:
+		return types.EndReasonMaxDuration
+	case b.limits.MaxTokens > 0 && b.tokens >= b.limits.MaxTokens:
+		return types.EndReasonMaxTokens
+	}
+	return ""
+}
+
+// Spend records one LLM turn and the tokens it used
+func (b *Budget) Spend(tokens int) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	b.turns++
+	b.tokens += tokens
+	b.mutex.Unlock()
+}
+
+// End marks the conversation as ended. It returns false if it had already ended.
+func (b *Budget) End() bool {
+	if b == nil {
+		return true
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.ended {
+		return false
+	}
+	b.ended = true
+	return true
+}
+
+// EndText returns a message for the UI describing why the conversation ended
+func (b *Budget) EndText(reason string) string {
+	switch reason {
+	case types.EndReasonMaxTurns:
+		return fmt.Sprintf("The conversation has ended after %d turns.", b.limits.MaxTurns)
+	case types.EndReasonMaxDuration:
+		return fmt.Sprintf("The conversation has ended after %s.", b.limits.MaxDuration)
+	case types.EndReasonMaxTokens:
+		return fmt.Sprintf("The conversation has ended after using its budget of %d tokens.", b.limits.MaxTokens)
+	}
+	return "The conversation has ended."
+}
@@ -0,0 +1,159 @@
+package ai
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/dmh2000/ai-server/internal/delivery"
+	"github.com/dmh2000/ai-server/internal/logger"
+	"github.com/dmh2000/ai-server/internal/parser"
+	"github.com/dmh2000/ai-server/internal/persona"
+	"github.com/dmh2000/ai-server/internal/types"
+	"github.com/dmh2000/ai-server/internal/window"
+)
+
+// Conversation is what the AI components of a conversation share with each
+// other and with the session that hosts them
+type Conversation struct {
+	Budget   *Budget        // checked before every turn
+	Gate     *Gate          // holds every turn while the operator has paused the conversation
+	Turns    *Turns         // context of the turns, cancelled when the conversation is reset or ends
+	Recorder Recorder       // receives each turn, nil to not record
+	Speaker  Speaker        // voices each turn, nil for text only
+	Prompts  PromptSource   // where the system prompts are read from each turn, nil for the personas' own
+	Counter  window.Counter // counts the tokens of the queries, nil to estimate
+
+	OnEnd   func(reason string)             // the conversation must end
+	OnError func(persona string, err error) // a turn failed
+}
+
+// component is the part of an AI component that does not depend on its role:
+// the conversation it takes part in, its channel to the UI, its worker and
+// whether it is paused
+type component struct {
+	Conversation
+	name       string // in the log
+	toUI       *delivery.Channel
+	trimmer    window.Trimmer
+	worker     *worker
+	paused     bool
+	pauseMutex sync.Mutex
+}
+
+// newComponent creates the shared part of the AI component with the given
+// display name, which sends to the UI on toUI
+func newComponent(name string, toUI *delivery.Channel) component {
+	return component{name: name, toUI: toUI, worker: newWorker(name)}
+}
+
+// SetConversation sets the conversation the component takes part in
+func (c *component) SetConversation(conversation Conversation) {
+	c.Conversation = conversation
+}
+
+// SetTrimmer sets how the context is kept within the token limit
+func (c *component) SetTrimmer(trimmer window.Trimmer) {
+	c.trimmer = trimmer
+}
+
+// isPaused returns whether the component is paused
+func (c *component) isPaused() bool {
+	c.pauseMutex.Lock()
+	defer c.pauseMutex.Unlock()
+	return c.paused
+}
+
+// prompt returns a persona's current system prompt, its own by default
+func (c *component) prompt(p *persona.Persona) string {
+	if c.Prompts == nil {
+		return p.Prompt
+	}
+	return c.Prompts.Prompt(p.Name)
+}
+
+// speak voices a persona's text with the speaker, if any, and returns the audio URL
+func (c *component) speak(ctx context.Context, p *persona.Persona, text string) string {
+	if c.Speaker == nil {
+		return ""
+	}
+	url, err := c.Speaker.Speak(ctx, p.Name, text)
+	if err != nil {
+		logger.Printf("%s AI failed to synthesize speech: %v", p.DisplayName, err)
+		return ""
+	}
+	return url
+}
+
+// parse parses a persona's output, falling back to a reply with the fallback
+// text if it cannot be repaired. Rejected and repaired replies are logged and
+// counted.
+func (c *component) parse(p *persona.Persona, output string, fallback string) *parser.Result {
+	reply, err := parser.Parse(p.Root, output)
+	if err != nil {
+		logger.Printf("Error parsing %s's reply: %v: %s", p.DisplayName, err, output)
+		invalidReplies.Inc(p.Name, "rejected")
+		return &parser.Result{Root: p.Root, Text: fallback}
+	}
+	if len(reply.Repairs) > 0 {
+		logger.Printf("Repaired %s's reply (%s): %s", p.DisplayName, strings.Join(reply.Repairs, ", "), output)
+		invalidReplies.Inc(p.Name, "repaired")
+	}
+	return reply
+}
+
+// record counts a turn and passes it to the recorder, if any
+func (c *component) record(speaker string, raw string, text string) {
+	turnsTaken.Inc(speaker)
+	if c.Recorder != nil {
+		c.Recorder.Record(speaker, raw, text)
+	}
+}
+
+// exhausted reports whether the conversation budget is used up, in which case
+// the conversation is ended instead of taking the turn
+func (c *component) exhausted() bool {
+	reason := c.Budget.Check()
+	if reason == "" {
+		return false
+	}
+	if c.OnEnd != nil {
+		c.OnEnd(reason)
+	}
+	return true
+}
+
+// finish takes the result of the worker's running turn
+func (c *component) finish(err error) {
+	c.worker.finish(err, c.OnError)
+}
+
+// send passes msg, labeled with the generation of the turn running under ctx,
+// to the UI
+func (c *component) send(ctx context.Context, msg types.ConversationMessage) error {
+	return c.toUI.Send(ctx, stamp(ctx, msg))
+}
+
+// End pauses processing and tells the UI the conversation has ended
+func (c *component) End(reason string, text string) {
+	c.pauseMutex.Lock()
+	c.paused = true
+	c.pauseMutex.Unlock()
+	logger.Printf("%s AI conversation ended: %s", c.name, reason)
+
+	c.send(c.Turns.Context(), types.ConversationMessage{
+		Type:   types.MessageTypeConversationEnd,
+		Text:   text,
+		Reason: reason,
+	})
+}
+
+// ReportError tells the UI a turn failed. The conversation waits for the
+// operator's next message.
+func (c *component) ReportError(text string, class string) {
+	c.send(c.Turns.Context(), types.ConversationMessage{
+		Type:   types.MessageTypeError,
+		Text:   text,
+		Reason: class,
+	})
+}
@@ -0,0 +1,34 @@
+package ai
+
+import (
+	"testing"
+
+	"github.com/dmh2000/ai-server/internal/persona"
+)
+
+func TestParse(t *testing.T) {
+	bob := &persona.Persona{Name: "bob", DisplayName: "Bob", Root: "bob"}
+	tests := []struct {
+		name        string
+		output      string
+		wantText    string
+		wantRepairs int
+	}{
+		{"valid", "<bob>Why?</bob>", "Why?", 0},
+		{"repaired", "```xml\n<bob>Why?</bob>\n```", "Why?", 1},
+		{"rejected", "<alice>Because.</alice>", "fallback", 0},
+		{"empty", "", "fallback", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c component
+			reply := c.parse(bob, tt.output, "fallback")
+			if reply.Root != "bob" || reply.Text != tt.wantText {
+				t.Errorf("parse = <%s>%q, want <bob>%q", reply.Root, reply.Text, tt.wantText)
+			}
+			if len(reply.Repairs) != tt.wantRepairs {
+				t.Errorf("repairs %q, want %d", reply.Repairs, tt.wantRepairs)
+			}
+		})
+	}
+}
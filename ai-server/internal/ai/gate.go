@@ -0,0 +1,91 @@
+package ai
+
+import (
+	"context"
+	"sync"
+)
+
+// Gate lets the operator hold a conversation between turns and release it one
+// turn at a time. One Gate is shared by all AI components of a conversation,
+// so a step allows exactly one more turn of whichever persona is next.
+type Gate struct {
+	mutex   sync.Mutex
+	held    bool
+	steps   int           // turns allowed while held
+	changed chan struct{} // closed when the gate may have opened
+}
+
+// NewGate creates an open gate
+func NewGate() *Gate {
+	return &Gate{changed: make(chan struct{})}
+}
+
+// Pause holds the conversation before its next turn
+func (g *Gate) Pause() {
+	g.mutex.Lock()
+	g.held = true
+	g.steps = 0
+	g.mutex.Unlock()
+}
+
+// Resume lets the conversation run freely
+func (g *Gate) Resume() {
+	g.mutex.Lock()
+	g.held = false
+	g.steps = 0
+	g.notify()
+	g.mutex.Unlock()
+}
+
+// Step allows exactly one more turn and then holds the conversation
+func (g *Gate) Step() {
+	g.mutex.Lock()
+	g.held = true
+	g.steps++
+	g.notify()
+	g.mutex.Unlock()
+}
+
+// Held reports whether the conversation is held
+func (g *Gate) Held() bool {
+	if g == nil {
+		return false
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.held
+}
+
+// notify wakes the turns waiting at the gate; the caller holds the mutex
+func (g *Gate) notify() {
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
+
+// Wait blocks until the next turn may run and takes it. It returns false if
+// ctx is done first.
+func (g *Gate) Wait(ctx context.Context) bool {
+	if g == nil {
+		return true
+	}
+	for {
+		g.mutex.Lock()
+		if !g.held {
+			g.mutex.Unlock()
+			return true
+		}
+		if g.steps > 0 {
+			g.steps--
+			g.mutex.Unlock()
+			return true
+		}
+		changed := g.changed
+		g.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-changed:
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package ai
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// passes reports whether a turn passes the gate within a short time
+func passes(g *Gate) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	return g.Wait(ctx)
+}
+
+func TestGate(t *testing.T) {
+	tests := []struct {
+		name       string
+		actions    func(g *Gate)
+		wantPasses []bool // whether each of the following turns passes
+		wantHeld   bool
+	}{
+		{
+			name:       "open",
+			actions:    func(g *Gate) {},
+			wantPasses: []bool{true, true, true},
+		},
+		{
+			name:       "paused",
+			actions:    func(g *Gate) { g.Pause() },
+			wantPasses: []bool{false, false},
+			wantHeld:   true,
+		},
+		{
+			name:       "one step",
+			actions:    func(g *Gate) { g.Pause(); g.Step() },
+			wantPasses: []bool{true, false},
+			wantHeld:   true,
+		},
+		{
+			name:       "steps add up",
+			actions:    func(g *Gate) { g.Step(); g.Step() },
+			wantPasses: []bool{true, true, false},
+			wantHeld:   true,
+		},
+		{
+			name:       "pause forgets steps",
+			actions:    func(g *Gate) { g.Step(); g.Step(); g.Pause() },
+			wantPasses: []bool{false},
+			wantHeld:   true,
+		},
+		{
+			name:       "resumed",
+			actions:    func(g *Gate) { g.Pause(); g.Step(); g.Resume() },
+			wantPasses: []bool{true, true, true},
+		},
+		{
+			name:       "resume forgets steps",
+			actions:    func(g *Gate) { g.Step(); g.Resume(); g.Pause() },
+			wantPasses: []bool{false},
+			wantHeld:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGate()
+			tt.actions(g)
+			if g.Held() != tt.wantHeld {
+				t.Errorf("Held = %v, want %v", g.Held(), tt.wantHeld)
+			}
+			for i, want := range tt.wantPasses {
+				if got := passes(g); got != want {
+					t.Errorf("turn %d passed = %v, want %v", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGateReleasesWaitingTurn(t *testing.T) {
+	tests := []struct {
+		name    string
+		release func(g *Gate)
+	}{
+		{"step", (*Gate).Step},
+		{"resume", (*Gate).Resume},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGate()
+			g.Pause()
+			passed := make(chan bool)
+			go func() { passed <- g.Wait(context.Background()) }()
+
+			time.Sleep(10 * time.Millisecond)
+			tt.release(g)
+			select {
+			case ok := <-passed:
+				if !ok {
+					t.Error("Wait = false, want true")
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("the waiting turn was not released")
+			}
+		})
+	}
+}
+
+func TestGateStepReleasesOneOfTwo(t *testing.T) {
+	g := NewGate()
+	g.Pause()
+	ctx, cancel := context.WithCancel(context.Background())
+	passed := make(chan bool, 2)
+	for range 2 {
+		go func() { passed <- g.Wait(ctx) }()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	g.Step()
+	if ok := <-passed; !ok {
+		t.Fatal("the first turn did not pass")
+	}
+	select {
+	case <-passed:
+		t.Fatal("one step let two turns pass")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// cancelling the turn still waiting ends its wait
+	cancel()
+	if ok := <-passed; ok {
+		t.Error("the cancelled turn passed")
+	}
+}
+
+func TestNilGate(t *testing.T) {
+	var g *Gate
+	if g.Held() || !g.Wait(context.Background()) {
+		t.Error("a nil gate holds turns")
+	}
+}
@@ -0,0 +1,128 @@
+package ai
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/llm"
+	"github.com/dmh2000/ai-server/internal/logger"
+	"github.com/dmh2000/ai-server/internal/parser"
+	"github.com/dmh2000/ai-server/internal/persona"
+	"github.com/dmh2000/ai-server/internal/window"
+)
+
+// turnHistory is a persona's context: the turns of the conversation as the
+// persona sees them. Its turns run in the worker while the session may reset
+// it, so it is guarded by a mutex, and a turn only changes it while the turn
+// has not been cancelled, so nothing of a reset conversation crosses into the
+// next one.
+type turnHistory struct {
+	mutex    sync.Mutex
+	messages []llm.Message
+}
+
+// get returns a copy of the messages
+func (h *turnHistory) get() []llm.Message {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]llm.Message(nil), h.messages...)
+}
+
+// add appends messages for the turn running under ctx. It adds nothing and
+// returns false if the turn was cancelled.
+func (h *turnHistory) add(ctx context.Context, messages ...llm.Message) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if ctx.Err() != nil {
+		return false
+	}
+	h.messages = append(h.messages, messages...)
+	return true
+}
+
+// clear forgets all messages
+func (h *turnHistory) clear() {
+	h.mutex.Lock()
+	h.messages = nil
+	h.mutex.Unlock()
+}
+
+// trim fits the messages and system prompt into the token limit, if a trimmer
+// is set; name is the persona's display name in the log. Dropped messages are
+// forgotten. The trimmed history is dropped if the turn was cancelled or the
+// history changed while it was trimmed.
+func (h *turnHistory) trim(ctx context.Context, trimmer window.Trimmer, name string, system string) {
+	if trimmer == nil {
+		return
+	}
+	history := h.get()
+	trimmed, err := trimmer.Trim(ctx, system, history)
+	if err != nil {
+		logger.Printf("%s AI failed to trim its context: %v", name, err)
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if ctx.Err() != nil || len(h.messages) != len(history) {
+		return
+	}
+	if len(trimmed) != len(history) {
+		logger.Printf("%s AI trimmed its context from %d to %d entries", name, len(history), len(trimmed))
+	}
+	h.messages = trimmed
+}
+
+// message returns speaker's turn as it appears in the history of the persona self
+func message(self string, speaker string, content string) llm.Message {
+	return llm.Message{
+		Speaker: speaker,
+		Role:    llm.RoleOf(speaker, self),
+		Content: content,
+		Time:    time.Now(),
+	}
+}
+
+// countTokens returns the token count of texts
+func (c *component) countTokens(texts ...string) int {
+	counter := c.Counter
+	if counter == nil {
+		counter = window.Estimate{}
+	}
+	n := 0
+	for _, text := range texts {
+		n += counter.Count(text)
+	}
+	return n
+}
+
+// historyTokens returns the token count of a history, counting the messages
+// the trimmer has not counted yet
+func (c *component) historyTokens(history []llm.Message) int {
+	n := 0
+	for _, m := range history {
+		if m.Tokens > 0 {
+			n += m.Tokens
+		} else {
+			n += c.countTokens(m.Content)
+		}
+	}
+	return n
+}
+
+// operatorNotes returns the operator's notes as they appear in the history of
+// the persona self, in <moderator> tags
+func operatorNotes(self string, notes []string) []llm.Message {
+	messages := make([]llm.Message, 0, len(notes))
+	for _, note := range notes {
+		raw := (&parser.Result{Root: persona.ModeratorName, Text: note}).XML()
+		messages = append(messages, message(self, persona.ModeratorName, raw))
+	}
+	return messages
+}
+
+// topicNote is the note that asks the asker to change the topic
+func topicNote(topic string) string {
+	return "Change the topic to: " + topic + ". Ask your next question about the new topic."
+}
@@ -0,0 +1,69 @@
+package ai
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/parser"
+)
+
+// humanPlayer is a person playing a persona through its web client. When it
+// is the persona's turn, its AI waits for the person's reply instead of
+// querying the model, and falls back to the model after the timeout.
+type humanPlayer struct {
+	timeout  time.Duration // 0 to wait indefinitely
+	mutex    sync.Mutex
+	waiting  bool
+	deadline <-chan time.Time
+}
+
+// newHumanPlayer creates a human player with a reply timeout
+func newHumanPlayer(timeout time.Duration) *humanPlayer {
+	return &humanPlayer{timeout: timeout}
+}
+
+// wait starts the person's turn
+func (h *humanPlayer) wait() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.waiting = true
+	h.deadline = nil
+	if h.timeout > 0 {
+		h.deadline = time.After(h.timeout)
+	}
+}
+
+// take ends the person's turn. It returns false if it was not their turn.
+func (h *humanPlayer) take() bool {
+	if h == nil {
+		return false
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	waiting := h.waiting
+	h.waiting = false
+	h.deadline = nil
+	return waiting
+}
+
+// expired returns a channel that receives when the person's turn times out,
+// or nil if it is not their turn
+func (h *humanPlayer) expired() <-chan time.Time {
+	if h == nil {
+		return nil
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.deadline
+}
+
+// displayText returns the text of a turn's XML. Turns passed between the AIs
+// are written by parser.Result.XML, so the root is the first tag.
+func displayText(raw string) string {
+	root, _, _ := strings.Cut(strings.TrimPrefix(raw, "<"), ">")
+	if reply, err := parser.Parse(root, raw); err == nil {
+		return reply.Text
+	}
+	return raw
+}
@@ -0,0 +1,64 @@
+package ai
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHumanPlayer(t *testing.T) {
+	h := newHumanPlayer(0)
+	if h.take() {
+		t.Error("take before the person's turn = true")
+	}
+
+	h.wait()
+	if h.expired() != nil {
+		t.Error("a turn without a timeout expires")
+	}
+	if !h.take() {
+		t.Error("take during the person's turn = false")
+	}
+	if h.take() {
+		t.Error("the person's turn was taken twice")
+	}
+}
+
+func TestHumanPlayerTimeout(t *testing.T) {
+	h := newHumanPlayer(10 * time.Millisecond)
+	h.wait()
+	select {
+	case <-h.expired():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the person's turn did not time out")
+	}
+	if !h.take() {
+		t.Error("take after the timeout = false, want the model to take the turn")
+	}
+	if h.expired() != nil {
+		t.Error("the timeout is still set after the turn was taken")
+	}
+}
+
+func TestNilHumanPlayer(t *testing.T) {
+	var h *humanPlayer
+	if h.take() || h.expired() != nil {
+		t.Error("a nil human player takes turns")
+	}
+}
+
+func TestDisplayText(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"<bob>Why?</bob>", "Why?"},
+		{"<alice>Fish &amp; chips</alice>", "Fish & chips"},
+		{"<error><content>Huh?</content></error>", "Huh?"},
+		{"plain", "plain"},
+	}
+	for _, tt := range tests {
+		if got := displayText(tt.raw); got != tt.want {
+			t.Errorf("displayText(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
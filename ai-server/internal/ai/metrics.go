@@ -0,0 +1,47 @@
+package ai
+
+import (
+	"context"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/llm"
+	"github.com/dmh2000/ai-server/internal/metrics"
+)
+
+// Metrics of the conversations, served at /metrics
+var (
+	turnsTaken = metrics.NewCounter("conversation_turns_total",
+		"Turns taken in conversations, by speaker", "persona")
+	queryDuration = metrics.NewHistogram("llm_query_duration_seconds",
+		"Duration of the model queries of turns including retries, by persona", metrics.DefaultBuckets, "persona")
+	queryErrors = metrics.NewCounter("llm_query_errors_total",
+		"Model queries of turns that failed, by persona and error class", "persona", "class")
+	tokensUsed = metrics.NewCounter("llm_tokens_total",
+		"Tokens of the model queries of turns, by persona and direction (in for the prompt, out for the reply)", "persona", "direction")
+	invalidReplies = metrics.NewCounter("llm_xml_validation_failures_total",
+		"Replies that were not valid XML, by persona and outcome (repaired, or rejected for the stock reply)", "persona", "outcome")
+)
+
+// queryStream queries a persona's model for a turn like llm.QueryStream, and
+// records its latency, error class and tokens, which are spent from the
+// conversation budget. A query cancelled with its turn is not recorded, since
+// it says nothing about the model.
+func (c *component) queryStream(ctx context.Context, name string, backend llm.Backend, system string, history []llm.Message, settings llm.Settings, onChunk func(chunk string)) (string, error) {
+	start := time.Now()
+	output, err := llm.QueryStream(ctx, backend, system, history, settings.Model, settings.Options(), onChunk)
+	if ctx.Err() != nil {
+		return output, err
+	}
+
+	queryDuration.Observe(time.Since(start).Seconds(), name)
+	if err != nil {
+		queryErrors.Inc(name, string(llm.Classify(err)))
+		return output, err
+	}
+	in := c.countTokens(system) + c.historyTokens(history)
+	out := c.countTokens(output)
+	tokensUsed.Add(float64(in), name, "in")
+	tokensUsed.Add(float64(out), name, "out")
+	c.Budget.Spend(in + out)
+	return output, nil
+}
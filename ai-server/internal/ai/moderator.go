@@ -0,0 +1,365 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/delivery"
+	"github.com/dmh2000/ai-server/internal/llm"
+	"github.com/dmh2000/ai-server/internal/logger"
+	"github.com/dmh2000/ai-server/internal/parser"
+	"github.com/dmh2000/ai-server/internal/persona"
+	"github.com/dmh2000/ai-server/internal/types"
+)
+
+// panelistFallback is the turn used when a panelist's output cannot be parsed
+const panelistFallback = "I'll pass for now."
+
+// Moderator hosts a round table: any number of personas taking turns in one
+// conversation. Every panelist's context is built from the shared
+// transcript, and a Scheduler picks who speaks next. The operator starts the
+// discussion, can interject at any time, and can name the next speaker by
+// starting a message with "@name".
+type Moderator struct {
+	component
+	panel          []*persona.Persona
+	backends       map[string]llm.Backend
+	scheduler      Scheduler
+	fromUI         <-chan types.ConversationMessage
+	next           chan struct{} // wakes the loop for the next turn
+	history        []Entry
+	selected       string // next speaker named by the operator
+	messages       int    // number of turns, used for message IDs
+	onStartNewConv func() // callback when new conversation starts
+}
+
+// NewModerator creates a round table of the panel. backends holds the LLM
+// backend of each panelist by name.
+func NewModerator(
+	panel []*persona.Persona,
+	scheduler Scheduler,
+	fromServer <-chan types.ConversationMessage,
+	toServer *delivery.Channel,
+	backends map[string]llm.Backend,
+) *Moderator {
+	m := &Moderator{
+		component: newComponent("Round table", toServer),
+		panel:     panel,
+		backends:  backends,
+		scheduler: scheduler,
+		fromUI:    fromServer,
+		next:      make(chan struct{}, 1),
+		history:   []Entry{},
+	}
+	m.paused = true
+	return m
+}
+
+// Reset clears the shared transcript and pauses the discussion
+func (m *Moderator) Reset() {
+	m.pauseMutex.Lock()
+	m.paused = true
+	m.history = []Entry{}
+	m.selected = ""
+	m.pauseMutex.Unlock()
+	logger.Println("Round table reset and paused")
+}
+
+// trimHistory fits the shared transcript and a panelist's system prompt into
+// the token limit, if a trimmer is set. Dropped entries are forgotten, and a
+// summary of them is kept as an entry of its own.
+func (m *Moderator) trimHistory(ctx context.Context, p *persona.Persona, system string) {
+	if m.trimmer == nil {
+		return
+	}
+	m.pauseMutex.Lock()
+	history := m.history
+	m.pauseMutex.Unlock()
+
+	messages := make([]llm.Message, 0, len(history))
+	for _, e := range history {
+		messages = append(messages, e.message(p.Name))
+	}
+	trimmed, err := m.trimmer.Trim(ctx, system, messages)
+	if err != nil {
+		logger.Printf("Round table failed to trim its transcript: %v", err)
+		return
+	}
+
+	// the kept entries are in order, anything else is a summary
+	kept := make([]Entry, 0, len(trimmed))
+	i := 0
+	for _, t := range trimmed {
+		for i < len(history) && (history[i].Raw != t.Content || !history[i].Time.Equal(t.Time)) {
+			i++
+		}
+		if i < len(history) {
+			e := history[i]
+			e.Tokens = t.Tokens
+			kept = append(kept, e)
+			i++
+			continue
+		}
+		kept = append(kept, Entry{Speaker: t.Speaker, Raw: t.Content, Text: t.Content, Time: t.Time, Tokens: t.Tokens})
+		i = 0
+	}
+	if len(kept) != len(history) {
+		logger.Printf("Round table trimmed its transcript from %d to %d entries", len(history), len(kept))
+	}
+
+	m.pauseMutex.Lock()
+	if ctx.Err() == nil && len(m.history) == len(history) {
+		m.history = kept
+	}
+	m.pauseMutex.Unlock()
+}
+
+// SetStartNewConvCallback sets the callback for when a new discussion starts
+func (m *Moderator) SetStartNewConvCallback(fn func()) {
+	m.onStartNewConv = fn
+}
+
+// wake schedules the next turn
+func (m *Moderator) wake() {
+	select {
+	case m.next <- struct{}{}:
+	default:
+	}
+}
+
+// Start begins processing messages. Turns are taken by the worker, so the
+// loop keeps handling operator messages while a panelist's query is outstanding.
+func (m *Moderator) Start(ctx context.Context) {
+	logger.Printf("Round table of %s started", strings.Join(m.names(), ", "))
+	defer m.worker.wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Println("Round table shutting down")
+			return
+
+		case msg := <-m.fromUI:
+			if m.Turns.Stale(msg) {
+				logger.Println("Round table dropping an operator message from before the last reset")
+				continue
+			}
+			m.processOperatorMessage(m.Turns.Context(), msg.Text)
+
+		case <-accept(m.worker, m.next):
+			if m.isPaused() {
+				continue
+			}
+			turn := m.Turns.Context()
+			m.worker.run(func() error { return m.takeTurn(turn) })
+
+		case err := <-m.worker.results:
+			m.finish(err)
+		}
+	}
+}
+
+// processOperatorMessage starts a new discussion if none is running, adds the
+// operator's text to the shared transcript and schedules the next turn
+func (m *Moderator) processOperatorMessage(ctx context.Context, input string) {
+	text := strings.TrimSpace(input)
+
+	// "@name ..." names the next speaker
+	if name, rest, ok := strings.Cut(text+" ", " "); ok && strings.HasPrefix(name, "@") {
+		p := m.find(strings.TrimPrefix(name, "@"))
+		if p == nil {
+			m.send(ctx, types.ConversationMessage{
+				Type: types.MessageTypeError,
+				Text: fmt.Sprintf("There is no %s at this round table.", name),
+			})
+			return
+		}
+		m.pauseMutex.Lock()
+		m.selected = p.Name
+		m.pauseMutex.Unlock()
+		text = strings.TrimSpace(rest)
+	}
+
+	if m.isPaused() {
+		if text == "" {
+			// only a speaker was named; keep it for the discussion's first turn
+			return
+		}
+		m.pauseMutex.Lock()
+		m.paused = false
+		m.history = []Entry{}
+		m.pauseMutex.Unlock()
+		if m.onStartNewConv != nil {
+			m.onStartNewConv()
+		}
+		logger.Println("Round table starting a new discussion")
+	}
+
+	if text != "" {
+		raw := (&parser.Result{Root: persona.ModeratorName, Text: text}).XML()
+		m.add(ctx, Entry{Speaker: persona.ModeratorName, Raw: raw, Text: text})
+		m.record(persona.ModeratorName, raw, text)
+		m.send(ctx, types.ConversationMessage{Text: text, Speaker: persona.ModeratorName})
+	}
+	m.wake()
+}
+
+// takeTurn lets the next speaker reply to the discussion so far and schedules
+// the turn after it. The turn runs under ctx, which is cancelled if the
+// conversation is reset.
+func (m *Moderator) takeTurn(ctx context.Context) error {
+	// Hold the turn while the operator has paused the conversation
+	if !m.Gate.Wait(ctx) || m.isPaused() {
+		return nil
+	}
+
+	// Stop once the conversation budget is used up
+	if m.exhausted() {
+		return nil
+	}
+
+	p, err := m.nextSpeaker(ctx)
+	if discarded(ctx, "Round table", "the choice of speaker") {
+		return nil
+	}
+	if err != nil {
+		logger.Printf("Error choosing the next speaker: %v", err)
+		return &turnError{persona: persona.ModeratorName, err: err}
+	}
+	if p == nil {
+		logger.Println("Round table waiting for the operator to name the next speaker")
+		return nil
+	}
+
+	reply, err := m.query(ctx, p)
+	if discarded(ctx, p.DisplayName, "the turn") {
+		return nil
+	}
+	if err != nil {
+		logger.Printf("Error querying LLM: %v", err)
+		return &turnError{persona: p.Name, err: err}
+	}
+
+	audio := m.speak(ctx, p, reply.Text)
+	if discarded(ctx, p.DisplayName, "the turn") {
+		return nil
+	}
+
+	// An error reply is shown but not added to the discussion
+	raw := reply.XML()
+	if !reply.IsError() {
+		m.add(ctx, Entry{Speaker: p.Name, Raw: raw, Text: reply.Text})
+	}
+	m.record(p.Name, raw, reply.Text)
+	m.send(ctx, types.ConversationMessage{
+		Type:    types.MessageTypeFinal,
+		ID:      fmt.Sprintf("%s-%d", p.Name, m.messages),
+		Text:    reply.Text,
+		Audio:   audio,
+		Speaker: p.Name,
+	})
+	logger.Printf("%s AI took a turn", p.DisplayName)
+
+	m.wake()
+	return nil
+}
+
+// nextSpeaker returns the panelist named by the operator, or else the one
+// picked by the scheduler. It returns nil to wait for the operator.
+func (m *Moderator) nextSpeaker(ctx context.Context) (*persona.Persona, error) {
+	m.pauseMutex.Lock()
+	name := m.selected
+	m.selected = ""
+	history := append([]Entry(nil), m.history...)
+	m.pauseMutex.Unlock()
+
+	if name == "" {
+		var err error
+		name, err = m.scheduler.Next(ctx, m.panel, history)
+		if err != nil || name == "" {
+			return nil, err
+		}
+	}
+	p := m.find(name)
+	if p == nil {
+		return nil, fmt.Errorf("scheduler chose %q, who is not at the table", name)
+	}
+	return p, nil
+}
+
+// query asks a panelist for its turn, streaming it to the UI as it is generated
+func (m *Moderator) query(ctx context.Context, p *persona.Persona) (*parser.Result, error) {
+	system := m.prompt(p)
+	m.trimHistory(ctx, p, system)
+	m.pauseMutex.Lock()
+	history := []llm.Message{message(p.Name, persona.ModeratorName, m.introduction(p))}
+	for _, e := range m.history {
+		history = append(history, e.message(p.Name))
+	}
+	m.pauseMutex.Unlock()
+
+	m.messages++
+	stream := newDeltaStream(ctx, fmt.Sprintf("%s-%d", p.Name, m.messages), m.toUI)
+	stream.speaker = p.Name
+	settings := p.Settings
+	output, err := m.queryStream(ctx, p.Name, m.backends[p.Name], system, history, settings, stream.onChunk)
+	if err == nil {
+		// a reply that arrives after its turn was cancelled belongs to no conversation
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Printf("<--- %s: %s", p.Name, output)
+
+	return m.parse(p, output, panelistFallback), nil
+}
+
+// introduction tells a panelist who else is at the table, ahead of the
+// shared transcript in its context
+func (m *Moderator) introduction(p *persona.Persona) string {
+	var others []string
+	for _, other := range m.panel {
+		if other != p {
+			others = append(others, fmt.Sprintf("%s (<%s>)", other.DisplayName, other.Root))
+		}
+	}
+	text := fmt.Sprintf("This is a round-table discussion between you, %s, and %s. "+
+		"The operator moderates in <%s> messages. When it is your turn, reply to the "+
+		"discussion so far inside <%s> tags.",
+		p.DisplayName, strings.Join(others, ", "), persona.ModeratorName, p.Root)
+	return (&parser.Result{Root: persona.ModeratorName, Text: text}).XML()
+}
+
+// add appends an entry to the shared transcript for the turn running under
+// ctx, unless the turn was cancelled
+func (m *Moderator) add(ctx context.Context, e Entry) {
+	e.Time = time.Now()
+	m.pauseMutex.Lock()
+	if ctx.Err() == nil {
+		m.history = append(m.history, e)
+	}
+	m.pauseMutex.Unlock()
+}
+
+// find returns the panelist with the given name or display name, or nil
+func (m *Moderator) find(name string) *persona.Persona {
+	for _, p := range m.panel {
+		if strings.EqualFold(name, p.Name) || strings.EqualFold(name, p.DisplayName) {
+			return p
+		}
+	}
+	return nil
+}
+
+// names returns the names of the panelists
+func (m *Moderator) names() []string {
+	names := make([]string, 0, len(m.panel))
+	for _, p := range m.panel {
+		names = append(names, p.Name)
+	}
+	return names
+}
@@ -0,0 +1,27 @@
+package ai
+
+import _ "embed"
+
+// Alice System Prompt
+//
+//go:embed alice-system.md
+var alicePrompt string
+
+// Bob System Prompt
+//
+//go:embed bob-system.md
+var bobPrompt string
+
+// PromptSource supplies a persona's current system prompt, e.g. from files
+// that are edited while the server runs
+type PromptSource interface {
+	Prompt(persona string) string
+}
+
+// DefaultPrompts returns the embedded system prompts of the built-in personas
+func DefaultPrompts() map[string]string {
+	return map[string]string{
+		"alice": alicePrompt,
+		"bob":   bobPrompt,
+	}
+}
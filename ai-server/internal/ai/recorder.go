@@ -0,0 +1,6 @@
+package ai
+
+// Recorder receives every turn of a conversation, e.g. to write a transcript
+type Recorder interface {
+	Record(speaker string, raw string, text string)
+}
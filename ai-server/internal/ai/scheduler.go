@@ -0,0 +1,151 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/llm"
+	"github.com/dmh2000/ai-server/internal/logger"
+	"github.com/dmh2000/ai-server/internal/parser"
+	"github.com/dmh2000/ai-server/internal/persona"
+)
+
+// Turn-taking strategies of a round table
+const (
+	StrategyRoundRobin = "round_robin" // the panelists speak in order
+	StrategyOperator   = "operator"    // the operator names every speaker
+	StrategyLLM        = "llm"         // a model picks the speaker best placed to continue
+)
+
+// ErrUnknownStrategy is returned for a turn-taking strategy that does not exist
+var ErrUnknownStrategy = errors.New("unknown turn-taking strategy")
+
+// Entry is one turn of a round table's shared transcript
+type Entry struct {
+	Speaker string    // persona name, or persona.ModeratorName for the operator
+	Raw     string    // XML as the panelists see it
+	Text    string    // cleaned text shown in the UI
+	Time    time.Time // when the turn was taken
+	Tokens  int       // token count of Raw, 0 until counted
+}
+
+// message returns the entry as it appears in the history of the persona self
+func (e Entry) message(self string) llm.Message {
+	return llm.Message{
+		Speaker: e.Speaker,
+		Role:    llm.RoleOf(e.Speaker, self),
+		Content: e.Raw,
+		Time:    e.Time,
+		Tokens:  e.Tokens,
+	}
+}
+
+// Scheduler picks who speaks next at a round table
+type Scheduler interface {
+	// Next returns the name of the next speaker, or "" to wait for the operator
+	Next(ctx context.Context, panel []*persona.Persona, history []Entry) (string, error)
+}
+
+// NewScheduler returns the scheduler of a turn-taking strategy. The llm
+// strategy queries backend with settings; the others ignore them.
+func NewScheduler(strategy string, backend llm.Backend, settings llm.Settings) (Scheduler, error) {
+	switch strategy {
+	case StrategyRoundRobin:
+		return RoundRobin{}, nil
+	case StrategyOperator:
+		return OperatorChoice{}, nil
+	case StrategyLLM:
+		return &LLMChooser{backend: backend, settings: settings}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownStrategy, strategy)
+}
+
+// RoundRobin lets the panelists speak in the order they were seated
+type RoundRobin struct{}
+
+// Next returns the panelist after the last one who spoke
+func (RoundRobin) Next(ctx context.Context, panel []*persona.Persona, history []Entry) (string, error) {
+	last := lastPanelist(panel, history)
+	for i, p := range panel {
+		if p.Name == last {
+			return panel[(i+1)%len(panel)].Name, nil
+		}
+	}
+	return panel[0].Name, nil
+}
+
+// OperatorChoice waits for the operator to name every speaker
+type OperatorChoice struct{}
+
+// Next always waits for the operator
+func (OperatorChoice) Next(ctx context.Context, panel []*persona.Persona, history []Entry) (string, error) {
+	return "", nil
+}
+
+// chooserRoot is the XML root tag of the LLM chooser's replies
+const chooserRoot = "next"
+
+// LLMChooser asks a model which panelist should speak next. It falls back to
+// round robin when the model's choice is not a panelist or the last speaker.
+type LLMChooser struct {
+	backend  llm.Backend
+	settings llm.Settings
+}
+
+// Next queries the model with the discussion so far
+func (c *LLMChooser) Next(ctx context.Context, panel []*persona.Persona, history []Entry) (string, error) {
+	last := lastPanelist(panel, history)
+	if len(history) == 0 {
+		return RoundRobin{}.Next(ctx, panel, history)
+	}
+	// the chooser is not at the table, so every turn is a user message
+	messages := make([]llm.Message, 0, len(history))
+	for _, e := range history {
+		messages = append(messages, e.message(""))
+	}
+
+	output, err := c.backend.QueryText(ctx, chooserPrompt(panel), messages, c.settings.Model, c.settings.Options())
+	if err != nil {
+		return "", err
+	}
+	if reply, err := parser.Parse(chooserRoot, output); err == nil {
+		choice := strings.ToLower(strings.TrimSpace(reply.Text))
+		for _, p := range panel {
+			if (choice == p.Name || choice == strings.ToLower(p.DisplayName)) && p.Name != last {
+				return p.Name, nil
+			}
+		}
+	}
+	logger.Printf("Next speaker chooser made no valid choice, using round robin: %s", output)
+	return RoundRobin{}.Next(ctx, panel, history)
+}
+
+// chooserPrompt is the system prompt of the LLM chooser
+func chooserPrompt(panel []*persona.Persona) string {
+	var b strings.Builder
+	b.WriteString("You moderate a round-table discussion. The participants are:\n")
+	for _, p := range panel {
+		fmt.Fprintf(&b, "- %s (%s), whose messages are in <%s> tags\n", p.Name, p.DisplayName, p.Root)
+	}
+	b.WriteString("Messages in <moderator> tags are from the operator.\n\n")
+	b.WriteString("Read the discussion so far and choose who should speak next, so that the " +
+		"discussion stays on topic and every participant contributes. Do not choose the " +
+		"participant who spoke last. Reply with only the participant's name inside <next> " +
+		"tags, e.g. <next>" + panel[0].Name + "</next>.")
+	return b.String()
+}
+
+// lastPanelist returns the name of the last panelist who spoke, or ""
+func lastPanelist(panel []*persona.Persona, history []Entry) string {
+	for i := len(history) - 1; i >= 0; i-- {
+		for _, p := range panel {
+			if history[i].Speaker == p.Name {
+				return p.Name
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,8 @@
+package ai
+
+import "context"
+
+// Speaker turns a persona's text into speech and returns the URL of the audio
+type Speaker interface {
+	Speak(ctx context.Context, persona string, text string) (string, error)
+}
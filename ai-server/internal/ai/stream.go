@@ -0,0 +1,69 @@
+package ai
+
+import (
+	"context"
+	"strings"
+
+	"github.com/dmh2000/ai-server/internal/delivery"
+	"github.com/dmh2000/ai-server/internal/types"
+)
+
+// deltaStream turns the raw XML a model streams into delta messages carrying
+// only the newly visible text, so a UI can show the response as it is generated.
+// The complete response follows as a final message with the same ID.
+type deltaStream struct {
+	id      string
+	speaker string // set at a round table, where the UI shows several personas
+	gen     generation
+	toUI    *delivery.Channel
+	ctx     context.Context
+	raw     strings.Builder
+	sent    int // length of the visible text already sent
+	seq     int
+}
+
+// newDeltaStream creates a stream of deltas for the message with the given ID,
+// generated by the turn running under ctx
+func newDeltaStream(ctx context.Context, id string, toUI *delivery.Channel) *deltaStream {
+	return &deltaStream{id: id, toUI: toUI, ctx: ctx, gen: generationOf(ctx)}
+}
+
+// onChunk accepts the next piece of the raw response. If the delta is dropped
+// the text is kept and sent with the next delta instead of being lost.
+func (d *deltaStream) onChunk(chunk string) {
+	d.raw.WriteString(chunk)
+	visible := visibleText(d.raw.String())
+	if len(visible) <= d.sent {
+		return
+	}
+
+	delta := d.gen.stamp(types.ConversationMessage{
+		Type:    types.MessageTypeDelta,
+		ID:      d.id,
+		Seq:     d.seq + 1,
+		Text:    visible[d.sent:],
+		Speaker: d.speaker,
+	})
+	if d.toUI.Send(d.ctx, delta) == nil {
+		d.seq++
+		d.sent = len(visible)
+	}
+}
+
+// visibleText strips XML tags from a partial response, including an
+// unterminated tag at the end, leaving the text a UI would show
+func visibleText(raw string) string {
+	var b strings.Builder
+	inTag := false
+	for _, r := range raw {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>' && inTag:
+			inTag = false
+		case !inTag:
+			b.WriteRune(r)
+		}
+	}
+	return strings.TrimLeft(b.String(), " \t\r\n")
+}
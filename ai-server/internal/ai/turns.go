@@ -0,0 +1,137 @@
+package ai
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dmh2000/ai-server/internal/logger"
+	"github.com/dmh2000/ai-server/internal/types"
+)
+
+// Turns gives the turns of a conversation a context that is cancelled when the
+// conversation is reset or ends, so model queries in flight are aborted rather
+// than finishing into the next conversation. It is derived from the context
+// the AI components are started with, so shutting down cancels it as well.
+//
+// Every reset starts a new generation of the conversation. The turn context
+// carries its generation, which labels the messages of the turn, so messages
+// of an earlier generation still buffered in a channel can be dropped.
+// One Turns is shared by all AI components of a conversation.
+type Turns struct {
+	mutex      sync.Mutex
+	parent     context.Context
+	ctx        context.Context
+	cancel     context.CancelFunc
+	generation generation
+}
+
+// generation identifies a conversation across resets
+type generation struct {
+	conversation string
+	number       uint64
+}
+
+// generationKey is the context key of the generation of a turn
+type generationKey struct{}
+
+// NewTurns creates the turn context of the conversation with the given ID,
+// whose AI components run under parent
+func NewTurns(parent context.Context, conversation string) *Turns {
+	t := &Turns{parent: parent, generation: generation{conversation: conversation, number: 1}}
+	t.renew()
+	return t
+}
+
+// renew creates the context of the next turns; the caller holds the mutex
+func (t *Turns) renew() {
+	ctx, cancel := context.WithCancel(t.parent)
+	t.ctx = context.WithValue(ctx, generationKey{}, t.generation)
+	t.cancel = cancel
+}
+
+// Context returns the context a turn starting now runs under
+func (t *Turns) Context() context.Context {
+	if t == nil {
+		return context.Background()
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.ctx
+}
+
+// Cancel aborts the turns in flight. Turns started afterwards get a new context
+// of the same generation.
+func (t *Turns) Cancel() {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.cancel()
+	t.renew()
+}
+
+// Advance aborts the turns in flight and starts a new generation, whose number
+// it returns
+func (t *Turns) Advance() uint64 {
+	if t == nil {
+		return 0
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.cancel()
+	t.generation.number++
+	t.renew()
+	return t.generation.number
+}
+
+// Generation returns the number of the current generation
+func (t *Turns) Generation() uint64 {
+	if t == nil {
+		return 0
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.generation.number
+}
+
+// Stamp labels msg with the conversation and its current generation
+func (t *Turns) Stamp(msg types.ConversationMessage) types.ConversationMessage {
+	return stamp(t.Context(), msg)
+}
+
+// Stale reports whether msg belongs to an earlier generation of the conversation
+func (t *Turns) Stale(msg types.ConversationMessage) bool {
+	if t == nil {
+		return false
+	}
+	return msg.Generation < t.Generation()
+}
+
+// generationOf returns the generation of the turn running under ctx
+func generationOf(ctx context.Context) generation {
+	g, _ := ctx.Value(generationKey{}).(generation)
+	return g
+}
+
+// stamp labels msg with the conversation and generation
+func (g generation) stamp(msg types.ConversationMessage) types.ConversationMessage {
+	msg.Conversation = g.conversation
+	msg.Generation = g.number
+	return msg
+}
+
+// stamp labels msg with the conversation and generation of the turn running under ctx
+func stamp(ctx context.Context, msg types.ConversationMessage) types.ConversationMessage {
+	return generationOf(ctx).stamp(msg)
+}
+
+// discarded reports whether the turn running under ctx was cancelled, in which
+// case its result must be dropped; what names the result in the log
+func discarded(ctx context.Context, name string, what string) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	logger.Printf("%s AI turn was cancelled, discarding %s", name, what)
+	return true
+}
@@ -0,0 +1,102 @@
+package ai
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dmh2000/ai-server/internal/types"
+)
+
+func TestTurnsAdvance(t *testing.T) {
+	turns := NewTurns(context.Background(), "c1")
+	first := turns.Context()
+	if got := turns.Generation(); got != 1 {
+		t.Fatalf("Generation = %d, want 1", got)
+	}
+
+	if got := turns.Advance(); got != 2 {
+		t.Errorf("Advance = %d, want 2", got)
+	}
+	if first.Err() == nil {
+		t.Error("Advance did not cancel the turns in flight")
+	}
+	second := turns.Context()
+	if second.Err() != nil {
+		t.Error("the turns after Advance are cancelled")
+	}
+	if g := generationOf(second); g != (generation{conversation: "c1", number: 2}) {
+		t.Errorf("turn generation = %+v, want c1 2", g)
+	}
+
+	// Cancel aborts the turns but keeps the generation
+	turns.Cancel()
+	if second.Err() == nil {
+		t.Error("Cancel did not cancel the turns in flight")
+	}
+	if turns.Context().Err() != nil || turns.Generation() != 2 {
+		t.Errorf("after Cancel: generation %d, cancelled %v", turns.Generation(), turns.Context().Err() != nil)
+	}
+}
+
+func TestTurnsFollowParent(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	turns := NewTurns(parent, "c1")
+	cancel()
+	if turns.Context().Err() == nil {
+		t.Error("cancelling the parent did not cancel the turns")
+	}
+	turns.Advance()
+	if turns.Context().Err() == nil {
+		t.Error("the turns of a new generation outlive the parent")
+	}
+}
+
+func TestTurnsStale(t *testing.T) {
+	turns := NewTurns(context.Background(), "c1")
+	turns.Advance()
+	turns.Advance()
+
+	tests := []struct {
+		generation uint64
+		want       bool
+	}{
+		{0, true},
+		{1, true},
+		{2, true},
+		{3, false},
+		{4, false},
+	}
+	for _, tt := range tests {
+		msg := types.ConversationMessage{Generation: tt.generation}
+		if got := turns.Stale(msg); got != tt.want {
+			t.Errorf("Stale(generation %d) = %v, want %v", tt.generation, got, tt.want)
+		}
+	}
+}
+
+func TestTurnsStamp(t *testing.T) {
+	turns := NewTurns(context.Background(), "c1")
+	turns.Advance()
+	msg := turns.Stamp(types.ConversationMessage{Text: "hi"})
+	if msg.Conversation != "c1" || msg.Generation != 2 || msg.Text != "hi" {
+		t.Errorf("Stamp = %+v, want c1 generation 2", msg)
+	}
+	if turns.Stale(msg) {
+		t.Error("a message stamped now is stale")
+	}
+	turns.Advance()
+	if !turns.Stale(msg) {
+		t.Error("a message of the last generation is not stale")
+	}
+}
+
+func TestNilTurns(t *testing.T) {
+	var turns *Turns
+	if turns.Context() == nil || turns.Advance() != 0 || turns.Generation() != 0 {
+		t.Error("a nil Turns has a generation")
+	}
+	turns.Cancel()
+	if turns.Stale(types.ConversationMessage{}) {
+		t.Error("a nil Turns finds messages stale")
+	}
+}
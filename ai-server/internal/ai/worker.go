@@ -0,0 +1,85 @@
+package ai
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/dmh2000/ai-server/internal/logger"
+)
+
+// worker runs the turns of an AI component in a goroutine, one at a time, so
+// its control loop stays responsive to shutdown, resets and operator messages
+// while a model query is outstanding. The loop starts turns with run, and
+// passes each result it receives from results to finish.
+//
+// Only the control loop may call run, finish and accept.
+type worker struct {
+	name    string
+	busy    bool           // a turn is running
+	pending []func() error // turns to start in order once the running one finishes
+	results chan error
+	wg      sync.WaitGroup
+}
+
+// turnError is the failure of a turn of the named persona
+type turnError struct {
+	persona string
+	err     error
+}
+
+func (e *turnError) Error() string { return e.persona + ": " + e.err.Error() }
+func (e *turnError) Unwrap() error { return e.err }
+
+// newWorker creates a worker for the AI component with the given display name
+func newWorker(name string) *worker {
+	return &worker{name: name, results: make(chan error, 1)}
+}
+
+// run starts turn in a goroutine. If a turn is already running, turn is queued
+// behind it and behind any turns queued before, so none of them is lost.
+func (w *worker) run(turn func() error) {
+	if w.busy {
+		w.pending = append(w.pending, turn)
+		logger.Printf("%s AI queued a turn behind the running one, %d waiting", w.name, len(w.pending))
+		return
+	}
+	w.busy = true
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.results <- turn()
+	}()
+}
+
+// finish takes the result of the running turn and starts the first queued
+// turn, if any. A failed turn is reported to onError.
+func (w *worker) finish(err error, onError func(persona string, err error)) {
+	w.busy = false
+	if len(w.pending) > 0 {
+		turn := w.pending[0]
+		w.pending = w.pending[1:]
+		w.run(turn)
+	}
+
+	var failed *turnError
+	if errors.As(err, &failed) && onError != nil {
+		onError(failed.persona, failed.err)
+	}
+}
+
+// wait blocks until the running turn has finished. Its result and the queued
+// turns are dropped.
+func (w *worker) wait() {
+	w.pending = nil
+	w.wg.Wait()
+}
+
+// accept returns ch while no turn is running and nil otherwise, so the control
+// loop only takes the next turn from ch once the running one has finished.
+// Meanwhile it stays in ch, which pushes back on the sender.
+func accept[T any](w *worker, ch <-chan T) <-chan T {
+	if w.busy {
+		return nil
+	}
+	return ch
+}
@@ -0,0 +1,154 @@
+package ai
+
+import (
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerRunsOneTurnAtATime(t *testing.T) {
+	w := newWorker("Test")
+	var running, most atomic.Int32
+	turn := func() error {
+		n := running.Add(1)
+		if n > most.Load() {
+			most.Store(n)
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+		return nil
+	}
+
+	for range 5 {
+		w.run(turn)
+	}
+	for range 5 {
+		w.finish(<-w.results, nil)
+	}
+	if n := most.Load(); n != 1 {
+		t.Errorf("%d turns ran at once, want 1", n)
+	}
+	select {
+	case <-w.results:
+		t.Error("a turn ran after the last one finished")
+	default:
+	}
+}
+
+func TestWorkerReportsFailedTurns(t *testing.T) {
+	cause := errors.New("503 unavailable")
+	tests := []struct {
+		name        string
+		err         error
+		wantPersona string
+	}{
+		{"succeeded", nil, ""},
+		{"failed turn", &turnError{persona: "bob", err: cause}, "bob"},
+		{"other error", cause, ""}, // only turn errors name a persona to report
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newWorker("Test")
+			w.run(func() error { return tt.err })
+
+			var persona string
+			var reported error
+			w.finish(<-w.results, func(p string, err error) { persona, reported = p, err })
+			if persona != tt.wantPersona {
+				t.Errorf("reported persona %q, want %q", persona, tt.wantPersona)
+			}
+			if tt.wantPersona != "" && reported != cause {
+				t.Errorf("reported %v, want %v", reported, cause)
+			}
+		})
+	}
+}
+
+func TestAccept(t *testing.T) {
+	w := newWorker("Test")
+	ch := make(chan int, 1)
+	if accept(w, ch) == nil {
+		t.Error("an idle worker does not accept")
+	}
+
+	release := make(chan struct{})
+	w.run(func() error {
+		<-release
+		return nil
+	})
+	ch <- 1
+	select {
+	case <-accept(w, ch):
+		t.Error("a busy worker accepted the next turn")
+	default:
+	}
+
+	close(release)
+	w.finish(<-w.results, nil)
+	select {
+	case v := <-accept(w, ch):
+		if v != 1 {
+			t.Errorf("accepted %d, want 1", v)
+		}
+	default:
+		t.Error("the next turn was not accepted once the running one finished")
+	}
+}
+
+func TestWorkerWaitDropsQueuedTurns(t *testing.T) {
+	w := newWorker("Test")
+	release := make(chan struct{})
+	var ran atomic.Bool
+	w.run(func() error {
+		<-release
+		return nil
+	})
+	w.run(func() error {
+		ran.Store(true)
+		return nil
+	})
+
+	close(release)
+	w.wait()
+	if len(w.pending) != 0 {
+		t.Errorf("%d turns queued after wait", len(w.pending))
+	}
+	<-w.results
+	if ran.Load() {
+		t.Error("the queued turn ran")
+	}
+}
+
+func TestWorkerQueuesTurns(t *testing.T) {
+	w := newWorker("Test")
+	release := make(chan struct{})
+	var ran []string
+	turn := func(name string) func() error {
+		return func() error {
+			ran = append(ran, name)
+			return nil
+		}
+	}
+
+	w.run(func() error {
+		<-release
+		return nil
+	})
+	w.run(turn("a"))
+	w.run(turn("b"))
+	w.run(turn("c"))
+	close(release)
+
+	// the control loop finishes each turn, starting the next one queued
+	for range 4 {
+		w.finish(<-w.results, nil)
+	}
+	if !reflect.DeepEqual(ran, []string{"a", "b", "c"}) {
+		t.Errorf("ran %q, want [a b c]", ran)
+	}
+	if w.busy || len(w.pending) != 0 {
+		t.Errorf("busy = %v with %d turns queued after the last one finished", w.busy, len(w.pending))
+	}
+}
@@ -0,0 +1,178 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/logger"
+	"github.com/dmh2000/ai-server/internal/metrics"
+	"github.com/dmh2000/ai-server/internal/types"
+)
+
+// Policies for a full channel
+const (
+	Block      = "block"       // wait for room up to the timeout, if any, then drop the message
+	DropOldest = "drop_oldest" // drop the oldest queued message to make room
+	DropNewest = "drop_newest" // drop the message being sent
+)
+
+// Channels of a conversation, named for their policies
+const (
+	AskerToAnswerer = "asker_to_answerer" // questions between the AIs of a pair
+	AnswererToAsker = "answerer_to_asker" // answers between the AIs of a pair
+	ServerToAI      = "server_to_ai"      // client messages to an AI
+	AIToServer      = "ai_to_server"      // AI messages to its clients
+)
+
+var (
+	// ErrDropped is returned when a message could not be delivered
+	ErrDropped = errors.New("message dropped")
+	// ErrUnknownPolicy is returned for a policy or channel that does not exist
+	ErrUnknownPolicy = errors.New("unknown delivery policy")
+)
+
+// dropped counts the messages dropped on each channel, served at /metrics
+var dropped = func() *metrics.Counter {
+	c := metrics.NewCounter("channel_dropped_messages_total",
+		"Messages dropped by full channels, by channel", "channel")
+	for name := range defaultPolicies {
+		c.Add(0, name)
+	}
+	return c
+}()
+
+// defaultPolicies keep the turns between the AIs and drop stale display
+// messages rather than the newest ones
+var defaultPolicies = map[string]string{
+	AskerToAnswerer: Block,
+	AnswererToAsker: Block,
+	ServerToAI:      Block,
+	AIToServer:      DropOldest,
+}
+
+// Options selects the policy of each channel
+type Options struct {
+	Policies map[string]string // by channel name, the defaults for channels not listed
+	Timeout  time.Duration     // how long Block waits for room, 0 to wait until the send is cancelled
+}
+
+// ParsePolicies parses "channel=policy" settings, e.g. "ai_to_server=drop_newest"
+func ParsePolicies(settings []string) (map[string]string, error) {
+	policies := map[string]string{}
+	for _, setting := range settings {
+		name, policy, _ := strings.Cut(setting, "=")
+		name, policy = strings.TrimSpace(name), strings.TrimSpace(policy)
+		if _, ok := defaultPolicies[name]; !ok {
+			return nil, fmt.Errorf("%w: no channel %q", ErrUnknownPolicy, name)
+		}
+		switch policy {
+		case Block, DropOldest, DropNewest:
+		default:
+			return nil, fmt.Errorf("%w: %q for %s", ErrUnknownPolicy, policy, name)
+		}
+		policies[name] = policy
+	}
+	return policies, nil
+}
+
+// Channel carries messages between a server and an AI component, or between
+// two AI components, and applies its policy when it is full
+type Channel struct {
+	name    string
+	ch      chan types.ConversationMessage
+	policy  string
+	timeout time.Duration
+	onDrop  func(msg types.ConversationMessage)
+}
+
+// New creates the named channel with room for size messages
+func New(name string, size int, opts Options) *Channel {
+	policy := opts.Policies[name]
+	if policy == "" {
+		policy = defaultPolicies[name]
+	}
+	return &Channel{
+		name:    name,
+		ch:      make(chan types.ConversationMessage, size),
+		policy:  policy,
+		timeout: opts.Timeout,
+	}
+}
+
+// Receive returns the receiving side of the channel
+func (c *Channel) Receive() <-chan types.ConversationMessage {
+	return c.ch
+}
+
+// OnDrop sets a callback for every message the channel drops, e.g. to tell the
+// clients a turn was lost
+func (c *Channel) OnDrop(fn func(msg types.ConversationMessage)) {
+	c.onDrop = fn
+}
+
+// Send delivers msg under the channel's policy. It returns ErrDropped if msg
+// was dropped; a message dropped to make room for msg is only reported to the
+// OnDrop callback. If ctx is done while waiting for room, msg is discarded
+// without counting it as dropped and ctx's error is returned.
+func (c *Channel) Send(ctx context.Context, msg types.ConversationMessage) error {
+	select {
+	case c.ch <- msg:
+		return nil
+	default:
+	}
+
+	switch c.policy {
+	case DropOldest:
+		for {
+			select {
+			case old := <-c.ch:
+				c.drop(old, "oldest")
+			default:
+			}
+			select {
+			case c.ch <- msg:
+				return nil
+			default:
+			}
+		}
+
+	case Block:
+		// without a timeout, expired is nil and never fires
+		var expired <-chan time.Time
+		if c.timeout > 0 {
+			timer := time.NewTimer(c.timeout)
+			defer timer.Stop()
+			expired = timer.C
+		}
+		select {
+		case c.ch <- msg:
+			return nil
+		case <-expired:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	c.drop(msg, "newest")
+	return fmt.Errorf("%w: %s is full", ErrDropped, c.name)
+}
+
+// drop counts and reports a dropped message; which names it in the log
+func (c *Channel) drop(msg types.ConversationMessage, which string) {
+	dropped.Inc(c.name)
+	logger.Printf("Channel %s full (%s), dropping %s %s message", c.name, c.policy, which, kind(msg))
+	if c.onDrop != nil {
+		c.onDrop(msg)
+	}
+}
+
+// kind names the type of a message in the log
+func kind(msg types.ConversationMessage) string {
+	if msg.Type == "" {
+		return "text"
+	}
+	return msg.Type
+}
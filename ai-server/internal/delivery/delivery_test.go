@@ -0,0 +1,249 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/types"
+)
+
+// text returns a message with the given text
+func text(s string) types.ConversationMessage {
+	return types.ConversationMessage{Text: s}
+}
+
+// newChannel returns a channel of the given policy that records what it drops
+func newChannel(policy string, size int, timeout time.Duration) (*Channel, *[]string) {
+	c := New(AskerToAnswerer, size, Options{Policies: map[string]string{AskerToAnswerer: policy}, Timeout: timeout})
+	var dropped []string
+	c.OnDrop(func(msg types.ConversationMessage) { dropped = append(dropped, msg.Text) })
+	return c, &dropped
+}
+
+// queued returns the texts of the messages waiting in a channel, emptying it
+func queued(c *Channel) []string {
+	var texts []string
+	for {
+		select {
+		case msg := <-c.Receive():
+			texts = append(texts, msg.Text)
+		default:
+			return texts
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		size        int
+		sends       []string
+		wantQueued  []string
+		wantDropped []string
+		wantErrs    int // sends that returned ErrDropped
+	}{
+		{
+			name:       "block with room",
+			policy:     Block,
+			size:       2,
+			sends:      []string{"a", "b"},
+			wantQueued: []string{"a", "b"},
+		},
+		{
+			name:        "block full",
+			policy:      Block,
+			size:        1,
+			sends:       []string{"a", "b"},
+			wantQueued:  []string{"a"},
+			wantDropped: []string{"b"},
+			wantErrs:    1,
+		},
+		{
+			name:       "drop oldest with room",
+			policy:     DropOldest,
+			size:       2,
+			sends:      []string{"a", "b"},
+			wantQueued: []string{"a", "b"},
+		},
+		{
+			name:        "drop oldest full",
+			policy:      DropOldest,
+			size:        2,
+			sends:       []string{"a", "b", "c", "d"},
+			wantQueued:  []string{"c", "d"},
+			wantDropped: []string{"a", "b"},
+		},
+		{
+			name:       "drop newest with room",
+			policy:     DropNewest,
+			size:       2,
+			sends:      []string{"a", "b"},
+			wantQueued: []string{"a", "b"},
+		},
+		{
+			name:        "drop newest full",
+			policy:      DropNewest,
+			size:        2,
+			sends:       []string{"a", "b", "c", "d"},
+			wantQueued:  []string{"a", "b"},
+			wantDropped: []string{"c", "d"},
+			wantErrs:    2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, dropped := newChannel(tt.policy, tt.size, time.Millisecond)
+			errs := 0
+			for _, s := range tt.sends {
+				err := c.Send(context.Background(), text(s))
+				switch {
+				case errors.Is(err, ErrDropped):
+					errs++
+				case err != nil:
+					t.Fatalf("Send(%q): %v", s, err)
+				}
+			}
+			if errs != tt.wantErrs {
+				t.Errorf("%d sends returned ErrDropped, want %d", errs, tt.wantErrs)
+			}
+			if got := queued(c); !reflect.DeepEqual(got, tt.wantQueued) {
+				t.Errorf("queued %q, want %q", got, tt.wantQueued)
+			}
+			if !reflect.DeepEqual(*dropped, tt.wantDropped) {
+				t.Errorf("dropped %q, want %q", *dropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestBlockWaitsForTimeout(t *testing.T) {
+	const timeout = 20 * time.Millisecond
+	c, dropped := newChannel(Block, 1, timeout)
+	c.Send(context.Background(), text("a"))
+
+	start := time.Now()
+	err := c.Send(context.Background(), text("b"))
+	if !errors.Is(err, ErrDropped) {
+		t.Fatalf("Send = %v, want %v", err, ErrDropped)
+	}
+	if waited := time.Since(start); waited < timeout {
+		t.Errorf("Send gave up after %v, want at least %v", waited, timeout)
+	}
+	if !reflect.DeepEqual(*dropped, []string{"b"}) {
+		t.Errorf("dropped %q, want [b]", *dropped)
+	}
+}
+
+func TestBlockDeliversWhenRoomFrees(t *testing.T) {
+	for _, timeout := range []time.Duration{time.Minute, 0} {
+		c, dropped := newChannel(Block, 1, timeout)
+		c.Send(context.Background(), text("a"))
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			<-c.Receive()
+		}()
+		if err := c.Send(context.Background(), text("b")); err != nil {
+			t.Errorf("timeout %v: Send = %v, want nil", timeout, err)
+		}
+		if got := queued(c); !reflect.DeepEqual(got, []string{"b"}) {
+			t.Errorf("timeout %v: queued %q, want [b]", timeout, got)
+		}
+		if len(*dropped) != 0 {
+			t.Errorf("timeout %v: dropped %q, want nothing", timeout, *dropped)
+		}
+	}
+}
+
+func TestBlockCancelled(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+	}{
+		{"with a timeout", time.Minute},
+		{"without a timeout", 0}, // waits until the send is cancelled
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, dropped := newChannel(Block, 1, tt.timeout)
+			c.Send(context.Background(), text("a"))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			err := c.Send(ctx, text("b"))
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Send = %v, want %v", err, context.DeadlineExceeded)
+			}
+			if len(*dropped) != 0 {
+				t.Errorf("dropped %q, want nothing: a cancelled message is not dropped", *dropped)
+			}
+			if got := queued(c); !reflect.DeepEqual(got, []string{"a"}) {
+				t.Errorf("queued %q, want [a]", got)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		channel  string
+		policies map[string]string
+		want     string
+	}{
+		{AskerToAnswerer, nil, Block},
+		{AnswererToAsker, nil, Block},
+		{ServerToAI, nil, Block},
+		{AIToServer, nil, DropOldest},
+		{AIToServer, map[string]string{AIToServer: DropNewest}, DropNewest},
+		{ServerToAI, map[string]string{AIToServer: DropNewest}, Block},
+	}
+	for _, tt := range tests {
+		c := New(tt.channel, 1, Options{Policies: tt.policies})
+		if c.policy != tt.want {
+			t.Errorf("New(%s, %v) policy = %s, want %s", tt.channel, tt.policies, c.policy, tt.want)
+		}
+	}
+}
+
+func TestParsePolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings []string
+		want     map[string]string
+		wantErr  bool
+	}{
+		{"none", nil, map[string]string{}, false},
+		{"one", []string{"ai_to_server=drop_newest"}, map[string]string{AIToServer: DropNewest}, false},
+		{"spaces", []string{" server_to_ai = drop_oldest "}, map[string]string{ServerToAI: DropOldest}, false},
+		{
+			"several",
+			[]string{"asker_to_answerer=drop_newest", "answerer_to_asker=block"},
+			map[string]string{AskerToAnswerer: DropNewest, AnswererToAsker: Block},
+			false,
+		},
+		{"unknown channel", []string{"nowhere=block"}, nil, true},
+		{"unknown policy", []string{"ai_to_server=drop_all"}, nil, true},
+		{"missing policy", []string{"ai_to_server"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePolicies(tt.settings)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnknownPolicy) {
+					t.Errorf("ParsePolicies error = %v, want %v", err, ErrUnknownPolicy)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePolicies: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePolicies = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
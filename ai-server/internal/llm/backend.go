@@ -0,0 +1,44 @@
+package llm
+
+import (
+	"context"
+
+	"github.com/dmh2000/ai-server/internal/logger"
+)
+
+// Backend is the interface the AI personas use to query a language model
+type Backend interface {
+	QueryText(ctx context.Context, system string, history []Message, model string, options Options) (string, error)
+}
+
+// ClientBackend is a Backend that forwards queries to a provider's chat model,
+// sending the history in the provider's chat format. The underlying model is
+// created lazily on the first query so the server can start without credentials.
+type ClientBackend struct {
+	chat    *chatModel
+	chatErr error // unsupported provider
+}
+
+// NewClientBackend creates a Backend for the given provider (e.g. "gemini")
+func NewClientBackend(provider string) *ClientBackend {
+	chat, err := newChatModel(provider)
+	return &ClientBackend{chat: chat, chatErr: err}
+}
+
+// QueryText sends the query to the provider and returns the complete response
+func (b *ClientBackend) QueryText(ctx context.Context, system string, history []Message, model string, options Options) (string, error) {
+	if b.chatErr != nil {
+		logger.Printf("Error creating LLM client: %v", b.chatErr)
+		return "", b.chatErr
+	}
+	return b.chat.query(ctx, system, history, model, options, nil)
+}
+
+// QueryStream streams the response, calling onChunk with each piece as it arrives
+func (b *ClientBackend) QueryStream(ctx context.Context, system string, history []Message, model string, options Options, onChunk func(chunk string)) (string, error) {
+	if b.chatErr != nil {
+		logger.Printf("Error creating LLM client: %v", b.chatErr)
+		return "", b.chatErr
+	}
+	return b.chat.query(ctx, system, history, model, options, onChunk)
+}
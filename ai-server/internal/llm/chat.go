@@ -0,0 +1,141 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/anthropic"
+	"github.com/tmc/langchaingo/llms/googleai"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// Supported providers
+const (
+	Anthropic = "anthropic"
+	Gemini    = "gemini"
+	OpenAI    = "openai"
+)
+
+// temperatureScales map a temperature from 0 to 1 to each provider's range
+var temperatureScales = map[string]float32{
+	Anthropic: 1.0,
+	Gemini:    2.0,
+	OpenAI:    2.0,
+}
+
+// defaultMaxTokens is the response limit of a model missing from maxOutputTokens
+const defaultMaxTokens = 4096
+
+// maxOutputTokens is the longest response of each known model
+var maxOutputTokens = map[string]int64{
+	"claude-sonnet-4-5-20250929": 64000,
+	"claude-opus-4-1-20250805":   32000,
+	"claude-3-5-haiku-20241022":  8096,
+	"gemini-2.5-pro":             64000,
+	"gemini-2.5-flash":           64000,
+	"gpt-5":                      64000,
+	"gpt-5-mini":                 64000,
+}
+
+// maxTokens returns the response limit of model
+func maxTokens(model string) int64 {
+	if n, ok := maxOutputTokens[model]; ok {
+		return n
+	}
+	return defaultMaxTokens
+}
+
+// chatModel queries a provider's langchaingo chat model
+type chatModel struct {
+	provider  string
+	modelOnce sync.Once
+	model     llms.Model
+	modelErr  error
+}
+
+// newChatModel returns the chat model of a provider
+func newChatModel(provider string) (*chatModel, error) {
+	if _, ok := temperatureScales[provider]; !ok {
+		return nil, fmt.Errorf("unsupported provider: %s", provider)
+	}
+	return &chatModel{provider: provider}, nil
+}
+
+// connect creates the langchaingo model from the provider's environment variables
+func (c *chatModel) connect() (llms.Model, error) {
+	switch c.provider {
+	case Anthropic:
+		apiKey := os.Getenv("ANTHROPIC_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("ANTHROPIC_API_KEY environment variable not set")
+		}
+		opts := []anthropic.Option{anthropic.WithToken(apiKey)}
+		if baseURL := os.Getenv("ANTHROPIC_BASE_URL"); baseURL != "" {
+			opts = append(opts, anthropic.WithBaseURL(baseURL))
+		}
+		return anthropic.New(opts...)
+
+	case OpenAI:
+		apiKey := os.Getenv("OPENAI_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("OPENAI_API_KEY environment variable not set")
+		}
+		opts := []openai.Option{openai.WithToken(apiKey)}
+		if baseURL := os.Getenv("OPENAI_BASE_URL"); baseURL != "" {
+			opts = append(opts, openai.WithBaseURL(baseURL))
+		}
+		return openai.New(opts...)
+	}
+
+	apiKey := os.Getenv("GEMINI_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("GEMINI_API_KEY environment variable not set")
+	}
+	return googleai.New(context.Background(), googleai.WithAPIKey(apiKey))
+}
+
+// query sends the system prompt and history as chat messages. If onChunk is
+// not nil, it is called with each piece of the response as it arrives.
+func (c *chatModel) query(ctx context.Context, system string, history []Message, model string, options Options, onChunk func(chunk string)) (string, error) {
+	c.modelOnce.Do(func() {
+		c.model, c.modelErr = c.connect()
+	})
+	if c.modelErr != nil {
+		return "", c.modelErr
+	}
+
+	if len(history) == 0 {
+		return "", fmt.Errorf("history cannot be empty for text query")
+	}
+
+	limit := options.MaxTokens
+	if limit <= 0 {
+		limit = maxTokens(model)
+	}
+	callOptions := []llms.CallOption{
+		llms.WithTemperature(float64(options.Temperature * temperatureScales[c.provider])),
+		llms.WithModel(model),
+		llms.WithMaxTokens(int(limit)),
+	}
+	if onChunk != nil {
+		callOptions = append(callOptions, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+			onChunk(string(chunk))
+			return nil
+		}))
+	}
+
+	completion, err := c.model.GenerateContent(ctx, chatContent(system, history), callOptions...)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate completion: %w", err)
+	}
+
+	var response strings.Builder
+	for _, choice := range completion.Choices {
+		response.WriteString(choice.Content)
+	}
+	return response.String(), nil
+}
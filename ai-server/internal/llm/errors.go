@@ -0,0 +1,82 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ErrorClass classifies a failed LLM query
+type ErrorClass string
+
+// Error classes
+const (
+	ErrorRateLimit     ErrorClass = "rate_limit"     // quota or request rate exceeded
+	ErrorTimeout       ErrorClass = "timeout"        // the query or connection timed out
+	ErrorAuth          ErrorClass = "auth"           // missing or invalid credentials
+	ErrorContentFilter ErrorClass = "content_filter" // the provider blocked the prompt or response
+	ErrorUnavailable   ErrorClass = "unavailable"    // the provider is overloaded or down
+	ErrorUnknown       ErrorClass = "unknown"
+)
+
+// Retryable reports whether a query that failed with this class may succeed
+// if repeated. Credentials and content do not change between attempts.
+func (c ErrorClass) Retryable() bool {
+	return c != ErrorAuth && c != ErrorContentFilter
+}
+
+// Error is a classified LLM query error
+type Error struct {
+	Class    ErrorClass
+	Model    string // model of the last attempt
+	Attempts int    // attempts made across all models
+	Err      error  // error of the last attempt
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s error from %s after %d attempts: %v", e.Class, e.Model, e.Attempts, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// errorPatterns maps substrings of provider error messages to classes. The
+// providers' clients mostly return plain errors, so the message is all there is.
+var errorPatterns = []struct {
+	class    ErrorClass
+	patterns []string
+}{
+	{ErrorRateLimit, []string{"429", "rate limit", "ratelimit", "quota", "resource_exhausted", "resource exhausted", "too many requests"}},
+	{ErrorAuth, []string{"401", "403", "api key", "api_key", "api-key", "authentication", "unauthenticated", "unauthorized", "permission denied", "permission_denied"}},
+	{ErrorContentFilter, []string{"safety", "blocked", "content filter", "content_filter", "content policy", "recitation"}},
+	{ErrorTimeout, []string{"timeout", "timed out", "deadline exceeded", "deadline_exceeded"}},
+	{ErrorUnavailable, []string{"500", "502", "503", "504", "unavailable", "overloaded", "internal error", "connection refused", "connection reset"}},
+}
+
+// Classify returns the class of a query error
+func Classify(err error) ErrorClass {
+	var llmErr *Error
+	if errors.As(err, &llmErr) {
+		return llmErr.Class
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorTimeout
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, p := range errorPatterns {
+		for _, pattern := range p.patterns {
+			if strings.Contains(message, pattern) {
+				return p.class
+			}
+		}
+	}
+	return ErrorUnknown
+}
@@ -0,0 +1,132 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeBackend is a deterministic, offline Backend for testing the conversation
+// loop without network access. It replays a script of canned replies in order,
+// wrapping each in the persona's root tag, and starts again from the top when
+// the script runs out. With no script it generates numbered placeholder replies.
+type FakeBackend struct {
+	root   string // persona root tag, e.g. "alice" or "bob"
+	script []string
+	delay  time.Duration
+	mutex  sync.Mutex
+	turn   int
+}
+
+// NewFakeBackend creates a fake backend for the persona with the given root tag.
+// delay simulates model latency and keeps the fake conversation at a readable pace.
+func NewFakeBackend(root string, script []string, delay time.Duration) *FakeBackend {
+	return &FakeBackend{
+		root:   root,
+		script: script,
+		delay:  delay,
+	}
+}
+
+// LoadScript reads a fake backend script, one reply per non-empty line.
+// Lines starting with '#' are comments. Lines starting with '!' make the
+// query fail with the rest of the line as the error, e.g. "!429 rate limit".
+func LoadScript(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var script []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		script = append(script, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return script, nil
+}
+
+// QueryText returns the next scripted reply
+func (f *FakeBackend) QueryText(ctx context.Context, system string, history []Message, model string, options Options) (string, error) {
+	if len(history) == 0 {
+		return "", fmt.Errorf("history cannot be empty for text query")
+	}
+
+	if err := sleep(ctx, f.delay); err != nil {
+		return "", err
+	}
+	return f.next()
+}
+
+// QueryStream returns the next scripted reply a word at a time, spreading the
+// simulated latency across the words
+func (f *FakeBackend) QueryStream(ctx context.Context, system string, history []Message, model string, options Options, onChunk func(chunk string)) (string, error) {
+	if len(history) == 0 {
+		return "", fmt.Errorf("history cannot be empty for text query")
+	}
+
+	reply, err := f.next()
+	if err != nil {
+		return "", err
+	}
+	chunks := strings.SplitAfter(reply, " ")
+	delay := f.delay / time.Duration(len(chunks))
+	for _, chunk := range chunks {
+		if err := sleep(ctx, delay); err != nil {
+			return "", err
+		}
+		onChunk(chunk)
+	}
+	return reply, nil
+}
+
+// next returns the next scripted reply wrapped in the persona's root tag, or
+// the scripted error
+func (f *FakeBackend) next() (string, error) {
+	f.mutex.Lock()
+	f.turn++
+	turn := f.turn
+	f.mutex.Unlock()
+
+	var reply string
+	if len(f.script) > 0 {
+		reply = f.script[(turn-1)%len(f.script)]
+	} else {
+		reply = fmt.Sprintf("%s reply %d", f.root, turn)
+	}
+
+	if message, ok := strings.CutPrefix(reply, "!"); ok {
+		return "", errors.New(message)
+	}
+
+	// scripts may contain bare text or complete XML
+	if !strings.HasPrefix(reply, "<") {
+		reply = "<" + f.root + ">" + reply + "</" + f.root + ">"
+	}
+	return reply, nil
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
@@ -0,0 +1,85 @@
+package llm
+
+import (
+	"strings"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Role is the chat role of a message from the perspective of the persona
+// being queried: its own turns are RoleAssistant, everyone else's RoleUser
+type Role string
+
+// Roles
+const (
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+)
+
+// RoleOf returns the role of speaker's turns in the history of the persona self
+func RoleOf(speaker string, self string) Role {
+	if speaker == self {
+		return RoleAssistant
+	}
+	return RoleUser
+}
+
+// Message is one turn of a conversation history
+type Message struct {
+	Speaker string    // persona name, or "moderator" for the operator
+	Role    Role      // role of the turn for the persona being queried
+	Content string    // raw XML, as the model sees it
+	Time    time.Time // when the turn was taken
+	Tokens  int       // token count of Content, 0 until counted
+}
+
+// Contents returns the content of each message
+func Contents(history []Message) []string {
+	contents := make([]string, 0, len(history))
+	for _, m := range history {
+		contents = append(contents, m.Content)
+	}
+	return contents
+}
+
+// openingText is the user message placed before a history that starts with
+// the persona's own turn, e.g. once the turns before it have been trimmed
+const openingText = "Begin the conversation."
+
+// chatContent converts a system prompt and history into langchaingo chat
+// messages. Consecutive messages with the same role are joined into one,
+// since Gemini and Anthropic expect user and assistant turns to alternate,
+// and the first message after the system prompt is always a user message,
+// since Anthropic rejects a conversation that starts with an assistant turn.
+func chatContent(system string, history []Message) []llms.MessageContent {
+	content := []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, system),
+	}
+
+	var texts []string
+	role := RoleUser
+	if len(history) > 0 && history[0].Role == RoleAssistant {
+		texts = []string{openingText}
+	}
+	flush := func() {
+		if len(texts) == 0 {
+			return
+		}
+		messageType := llms.ChatMessageTypeHuman
+		if role == RoleAssistant {
+			messageType = llms.ChatMessageTypeAI
+		}
+		content = append(content, llms.TextParts(messageType, strings.Join(texts, "\n\n")))
+		texts = nil
+	}
+	for _, m := range history {
+		if m.Role != role {
+			flush()
+			role = m.Role
+		}
+		texts = append(texts, m.Content)
+	}
+	flush()
+	return content
+}
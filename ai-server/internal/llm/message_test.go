@@ -0,0 +1,59 @@
+package llm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestChatContent(t *testing.T) {
+	user := func(content string) Message { return Message{Role: RoleUser, Content: content} }
+	assistant := func(content string) Message { return Message{Role: RoleAssistant, Content: content} }
+
+	tests := []struct {
+		name    string
+		history []Message
+		want    []llms.MessageContent
+	}{
+		{
+			name: "empty",
+			want: nil,
+		},
+		{
+			name:    "alternating",
+			history: []Message{user("q1"), assistant("a1"), user("q2")},
+			want: []llms.MessageContent{
+				llms.TextParts(llms.ChatMessageTypeHuman, "q1"),
+				llms.TextParts(llms.ChatMessageTypeAI, "a1"),
+				llms.TextParts(llms.ChatMessageTypeHuman, "q2"),
+			},
+		},
+		{
+			name:    "same roles joined",
+			history: []Message{user("q1"), user("note"), assistant("a1"), assistant("a2")},
+			want: []llms.MessageContent{
+				llms.TextParts(llms.ChatMessageTypeHuman, "q1\n\nnote"),
+				llms.TextParts(llms.ChatMessageTypeAI, "a1\n\na2"),
+			},
+		},
+		{
+			name:    "starts with the persona's own turn",
+			history: []Message{assistant("a1"), user("q2")},
+			want: []llms.MessageContent{
+				llms.TextParts(llms.ChatMessageTypeHuman, openingText),
+				llms.TextParts(llms.ChatMessageTypeAI, "a1"),
+				llms.TextParts(llms.ChatMessageTypeHuman, "q2"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chatContent("system", tt.history)
+			want := append([]llms.MessageContent{llms.TextParts(llms.ChatMessageTypeSystem, "system")}, tt.want...)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("chatContent = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
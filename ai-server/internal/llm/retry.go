@@ -0,0 +1,128 @@
+package llm
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/logger"
+)
+
+// RetryPolicy configures how RetryBackend retries failed queries
+type RetryPolicy struct {
+	MaxAttempts    int           // attempts per model, at least 1
+	BaseDelay      time.Duration // delay before the first retry, doubled for each further retry
+	MaxDelay       time.Duration // upper bound of the delay
+	FallbackModels []string      // models to try, in order, when the requested model keeps failing
+	Timeout        time.Duration // limit of each attempt, 0 for none
+}
+
+// RetryBackend wraps a Backend, retrying retryable errors with exponential
+// backoff and jitter and then falling back to the policy's other models.
+// Auth errors fail immediately since every model shares the credentials.
+// Failures are returned as *Error.
+type RetryBackend struct {
+	backend Backend
+	policy  RetryPolicy
+}
+
+// NewRetryBackend creates a backend that retries queries to backend
+func NewRetryBackend(backend Backend, policy RetryPolicy) *RetryBackend {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	return &RetryBackend{
+		backend: backend,
+		policy:  policy,
+	}
+}
+
+// QueryText queries the wrapped backend, retrying on failure
+func (r *RetryBackend) QueryText(ctx context.Context, system string, history []Message, model string, options Options) (string, error) {
+	return r.do(ctx, model, func(ctx context.Context, model string) (string, error) {
+		return r.backend.QueryText(ctx, system, history, model, options)
+	}, func() bool { return true })
+}
+
+// QueryStream streams from the wrapped backend, retrying on failure. Once
+// part of a response has been delivered it cannot be taken back, so a query
+// that fails mid-stream is not retried.
+func (r *RetryBackend) QueryStream(ctx context.Context, system string, history []Message, model string, options Options, onChunk func(chunk string)) (string, error) {
+	streamed := false
+	return r.do(ctx, model, func(ctx context.Context, model string) (string, error) {
+		return QueryStream(ctx, r.backend, system, history, model, options, func(chunk string) {
+			streamed = true
+			onChunk(chunk)
+		})
+	}, func() bool { return !streamed })
+}
+
+// do runs query against the model and then the fallback models until it
+// succeeds, the error is final or canRetry reports a retry is not possible
+func (r *RetryBackend) do(ctx context.Context, model string, query func(ctx context.Context, model string) (string, error), canRetry func() bool) (string, error) {
+	models := append([]string{model}, r.policy.FallbackModels...)
+	var last *Error
+	attempts := 0
+
+	for i, m := range models {
+		if i > 0 {
+			logger.Printf("LLM falling back from %s to %s", last.Model, m)
+		}
+		for attempt := 1; attempt <= r.policy.MaxAttempts; attempt++ {
+			attempts++
+			response, err := r.attempt(ctx, m, query)
+			if err == nil {
+				return response, nil
+			}
+
+			last = &Error{Class: Classify(err), Model: m, Attempts: attempts, Err: err}
+			if ctx.Err() != nil || !canRetry() || last.Class == ErrorAuth {
+				return "", last
+			}
+			if !last.Class.Retryable() || attempt == r.policy.MaxAttempts {
+				logger.Printf("LLM query to %s failed (%s): %v", m, last.Class, err)
+				break
+			}
+
+			delay := r.backoff(attempt)
+			logger.Printf("LLM query to %s failed (%s), retrying in %v: %v", m, last.Class, delay, err)
+			if err := sleep(ctx, delay); err != nil {
+				return "", last
+			}
+		}
+	}
+	return "", last
+}
+
+// attempt runs a single query, limited to the policy's timeout
+func (r *RetryBackend) attempt(ctx context.Context, model string, query func(ctx context.Context, model string) (string, error)) (string, error) {
+	if r.policy.Timeout <= 0 {
+		return query(ctx, model)
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.policy.Timeout)
+	defer cancel()
+	return query(ctx, model)
+}
+
+// backoff returns the delay before the retry following the given attempt:
+// exponential in the attempt, capped at MaxDelay, with the upper half jittered
+// so clients that failed together do not retry together
+func (r *RetryBackend) backoff(attempt int) time.Duration {
+	delay := r.policy.BaseDelay
+	for i := 1; i < attempt && delay > 0; i++ {
+		if delay > math.MaxInt64/2 {
+			delay = math.MaxInt64
+			break
+		}
+		delay *= 2
+	}
+	if r.policy.MaxDelay > 0 && delay > r.policy.MaxDelay {
+		delay = r.policy.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
@@ -0,0 +1,320 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// scriptedBackend fails with the scripted errors in order, then succeeds,
+// recording the model of each query
+type scriptedBackend struct {
+	errs   []error
+	models []string
+}
+
+func (b *scriptedBackend) QueryText(ctx context.Context, system string, history []Message, model string, options Options) (string, error) {
+	b.models = append(b.models, model)
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if len(b.errs) == 0 {
+		return "reply from " + model, nil
+	}
+	err := b.errs[0]
+	b.errs = b.errs[1:]
+	return "", err
+}
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorClass
+	}{
+		{errors.New("googleapi: Error 429: Resource has been exhausted"), ErrorRateLimit},
+		{errors.New("Too Many Requests"), ErrorRateLimit},
+		{errors.New("RESOURCE_EXHAUSTED: quota exceeded"), ErrorRateLimit},
+		{errors.New("401 Unauthorized"), ErrorAuth},
+		{errors.New("invalid x-api-key"), ErrorAuth},
+		{errors.New("PERMISSION_DENIED"), ErrorAuth},
+		{errors.New("response blocked by safety settings"), ErrorContentFilter},
+		{errors.New("finish reason: RECITATION"), ErrorContentFilter},
+		{errors.New("request timed out"), ErrorTimeout},
+		{context.DeadlineExceeded, ErrorTimeout},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), ErrorTimeout},
+		{&net.OpError{Op: "read", Err: timeoutError{}}, ErrorTimeout},
+		{errors.New("503 Service Unavailable"), ErrorUnavailable},
+		{errors.New("overloaded_error: Overloaded"), ErrorUnavailable},
+		{errors.New("dial tcp: connection refused"), ErrorUnavailable},
+		{errors.New("something went wrong"), ErrorUnknown},
+		{context.Canceled, ErrorUnknown},
+		{&Error{Class: ErrorContentFilter, Err: errors.New("429")}, ErrorContentFilter},
+		{fmt.Errorf("stream: %w", &Error{Class: ErrorAuth, Err: errors.New("x")}), ErrorAuth},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.err); got != tt.want {
+			t.Errorf("Classify(%q) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		class ErrorClass
+		want  bool
+	}{
+		{ErrorRateLimit, true},
+		{ErrorTimeout, true},
+		{ErrorUnavailable, true},
+		{ErrorUnknown, true},
+		{ErrorAuth, false},
+		{ErrorContentFilter, false},
+	}
+	for _, tt := range tests {
+		if got := tt.class.Retryable(); got != tt.want {
+			t.Errorf("%s.Retryable() = %v, want %v", tt.class, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     time.Duration
+		max      time.Duration
+		attempt  int
+		wantFull time.Duration // the delay before jitter
+	}{
+		{"first retry", 100 * time.Millisecond, time.Second, 1, 100 * time.Millisecond},
+		{"doubled", 100 * time.Millisecond, time.Second, 3, 400 * time.Millisecond},
+		{"capped", 100 * time.Millisecond, time.Second, 5, time.Second},
+		{"capped far out", 100 * time.Millisecond, time.Second, 40, time.Second},
+		{"capped past overflow", time.Second, time.Minute, 64, time.Minute},
+		{"capped past wraparound", 3 * time.Second, time.Minute, 63, time.Minute},
+		{"no cap", time.Second, 0, 4, 8 * time.Second},
+		{"no base", 0, time.Second, 1, 0},
+		{"nothing", 0, 0, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRetryBackend(&scriptedBackend{}, RetryPolicy{BaseDelay: tt.base, MaxDelay: tt.max})
+			for range 50 {
+				got := r.backoff(tt.attempt)
+				if got < tt.wantFull/2 || got > tt.wantFull {
+					t.Fatalf("backoff(%d) = %v, want between %v and %v", tt.attempt, got, tt.wantFull/2, tt.wantFull)
+				}
+			}
+		})
+	}
+}
+
+func TestBackoffWithoutCapDoesNotOverflow(t *testing.T) {
+	r := NewRetryBackend(&scriptedBackend{}, RetryPolicy{BaseDelay: time.Second})
+	for attempt := 1; attempt <= 70; attempt++ {
+		if got := r.backoff(attempt); got < time.Second/2 {
+			t.Fatalf("backoff(%d) = %v, want it never to shrink below the base delay", attempt, got)
+		}
+	}
+	if got := r.backoff(70); got < math.MaxInt64/2 {
+		t.Errorf("backoff(70) = %v, want the longest possible delay", got)
+	}
+}
+
+func TestRetryBackend(t *testing.T) {
+	unavailable := errors.New("503 unavailable")
+	auth := errors.New("401 invalid api key")
+	filtered := errors.New("blocked by safety filters")
+
+	tests := []struct {
+		name         string
+		errs         []error
+		attempts     int
+		fallbacks    []string
+		wantResponse string
+		wantModels   []string
+		wantClass    ErrorClass
+		wantAttempts int
+	}{
+		{
+			name:         "first attempt",
+			attempts:     3,
+			wantResponse: "reply from m1",
+			wantModels:   []string{"m1"},
+		},
+		{
+			name:         "retried",
+			errs:         []error{unavailable, unavailable},
+			attempts:     3,
+			wantResponse: "reply from m1",
+			wantModels:   []string{"m1", "m1", "m1"},
+		},
+		{
+			name:         "attempts exhausted",
+			errs:         []error{unavailable, unavailable, unavailable},
+			attempts:     2,
+			wantModels:   []string{"m1", "m1"},
+			wantClass:    ErrorUnavailable,
+			wantAttempts: 2,
+		},
+		{
+			name:         "fallback",
+			errs:         []error{unavailable, unavailable},
+			attempts:     2,
+			fallbacks:    []string{"m2"},
+			wantResponse: "reply from m2",
+			wantModels:   []string{"m1", "m1", "m2"},
+		},
+		{
+			name:         "all models fail",
+			errs:         []error{unavailable, unavailable, unavailable, unavailable},
+			attempts:     1,
+			fallbacks:    []string{"m2", "m3"},
+			wantModels:   []string{"m1", "m2", "m3"},
+			wantClass:    ErrorUnavailable,
+			wantAttempts: 3,
+		},
+		{
+			name:         "auth fails immediately",
+			errs:         []error{auth},
+			attempts:     3,
+			fallbacks:    []string{"m2"},
+			wantModels:   []string{"m1"},
+			wantClass:    ErrorAuth,
+			wantAttempts: 1,
+		},
+		{
+			name:         "content filter falls back without retrying",
+			errs:         []error{filtered},
+			attempts:     3,
+			fallbacks:    []string{"m2"},
+			wantResponse: "reply from m2",
+			wantModels:   []string{"m1", "m2"},
+		},
+		{
+			name:         "zero attempts means one",
+			errs:         []error{unavailable},
+			wantModels:   []string{"m1"},
+			wantClass:    ErrorUnavailable,
+			wantAttempts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &scriptedBackend{errs: tt.errs}
+			r := NewRetryBackend(backend, RetryPolicy{MaxAttempts: tt.attempts, FallbackModels: tt.fallbacks})
+
+			response, err := r.QueryText(context.Background(), "system", nil, "m1", Options{})
+			if response != tt.wantResponse {
+				t.Errorf("response = %q, want %q", response, tt.wantResponse)
+			}
+			if !reflect.DeepEqual(backend.models, tt.wantModels) {
+				t.Errorf("queried %q, want %q", backend.models, tt.wantModels)
+			}
+			if tt.wantClass == "" {
+				if err != nil {
+					t.Errorf("error = %v, want nil", err)
+				}
+				return
+			}
+			var llmErr *Error
+			if !errors.As(err, &llmErr) {
+				t.Fatalf("error = %v, want an *Error", err)
+			}
+			if llmErr.Class != tt.wantClass || llmErr.Attempts != tt.wantAttempts {
+				t.Errorf("error = %s after %d attempts, want %s after %d", llmErr.Class, llmErr.Attempts, tt.wantClass, tt.wantAttempts)
+			}
+			if want := tt.wantModels[len(tt.wantModels)-1]; llmErr.Model != want {
+				t.Errorf("error model = %s, want %s", llmErr.Model, want)
+			}
+		})
+	}
+}
+
+func TestRetryCancelledDuringBackoff(t *testing.T) {
+	backend := &scriptedBackend{errs: []error{errors.New("503 unavailable")}}
+	r := NewRetryBackend(backend, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Minute, FallbackModels: []string{"m2"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := r.QueryText(ctx, "system", nil, "m1", Options{})
+	if waited := time.Since(start); waited > 5*time.Second {
+		t.Errorf("QueryText returned after %v, want it to stop waiting when cancelled", waited)
+	}
+	if Classify(err) != ErrorUnavailable {
+		t.Errorf("error = %v, want the last query error", err)
+	}
+	if !reflect.DeepEqual(backend.models, []string{"m1"}) {
+		t.Errorf("queried %q, want [m1]: a cancelled query is neither retried nor falls back", backend.models)
+	}
+}
+
+func TestRetryCancelledDuringQuery(t *testing.T) {
+	backend := &scriptedBackend{}
+	r := NewRetryBackend(backend, RetryPolicy{MaxAttempts: 3, FallbackModels: []string{"m2"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := r.QueryText(ctx, "system", nil, "m1", Options{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want %v", err, context.Canceled)
+	}
+	if !reflect.DeepEqual(backend.models, []string{"m1"}) {
+		t.Errorf("queried %q, want [m1]", backend.models)
+	}
+}
+
+func TestRetryAttemptTimeout(t *testing.T) {
+	r := NewRetryBackend(&FakeBackend{root: "bob", delay: time.Minute}, RetryPolicy{MaxAttempts: 2, Timeout: 10 * time.Millisecond})
+
+	_, err := r.QueryText(context.Background(), "system", []Message{{Role: RoleUser, Content: "q"}}, "m1", Options{})
+	var llmErr *Error
+	if !errors.As(err, &llmErr) {
+		t.Fatalf("error = %v, want an *Error", err)
+	}
+	if llmErr.Class != ErrorTimeout || llmErr.Attempts != 2 {
+		t.Errorf("error = %s after %d attempts, want %s after 2", llmErr.Class, llmErr.Attempts, ErrorTimeout)
+	}
+}
+
+// streamingBackend streams a chunk and then fails
+type streamingBackend struct {
+	scriptedBackend
+}
+
+func (b *streamingBackend) QueryStream(ctx context.Context, system string, history []Message, model string, options Options, onChunk func(chunk string)) (string, error) {
+	b.models = append(b.models, model)
+	onChunk("partial ")
+	return "", errors.New("connection reset")
+}
+
+func TestRetryStreamNotRetriedAfterChunk(t *testing.T) {
+	backend := &streamingBackend{}
+	r := NewRetryBackend(backend, RetryPolicy{MaxAttempts: 3, FallbackModels: []string{"m2"}})
+
+	var chunks []string
+	_, err := r.QueryStream(context.Background(), "system", nil, "m1", Options{}, func(chunk string) { chunks = append(chunks, chunk) })
+	if Classify(err) != ErrorUnavailable {
+		t.Errorf("error = %v, want %s", err, ErrorUnavailable)
+	}
+	if !reflect.DeepEqual(backend.models, []string{"m1"}) {
+		t.Errorf("queried %q, want [m1]", backend.models)
+	}
+	if !reflect.DeepEqual(chunks, []string{"partial "}) {
+		t.Errorf("chunks %q, want [partial ]", chunks)
+	}
+}
@@ -0,0 +1,22 @@
+package llm
+
+// Settings selects the model and generation options of a persona's queries
+type Settings struct {
+	Model       string
+	Temperature float32 // 0 to 1, scaled to the provider's range
+	MaxTokens   int64   // response limit, 0 for the model's maximum
+}
+
+// Options are the generation options of a query
+type Options struct {
+	Temperature float32 // 0 to 1, scaled to the provider's range
+	MaxTokens   int64   // response limit, 0 for the model's maximum
+}
+
+// Options returns the query options for the settings
+func (s Settings) Options() Options {
+	return Options{
+		Temperature: s.Temperature,
+		MaxTokens:   s.MaxTokens,
+	}
+}
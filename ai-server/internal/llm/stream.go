@@ -0,0 +1,26 @@
+package llm
+
+import (
+	"context"
+)
+
+// Streamer is implemented by backends that can deliver a response incrementally
+type Streamer interface {
+	QueryStream(ctx context.Context, system string, history []Message, model string, options Options, onChunk func(chunk string)) (string, error)
+}
+
+// QueryStream queries the backend, calling onChunk with each piece of the
+// response as it arrives, and returns the complete response. Backends that
+// cannot stream deliver the whole response as a single chunk.
+func QueryStream(ctx context.Context, backend Backend, system string, history []Message, model string, options Options, onChunk func(chunk string)) (string, error) {
+	if streamer, ok := backend.(Streamer); ok {
+		return streamer.QueryStream(ctx, system, history, model, options, onChunk)
+	}
+
+	response, err := backend.QueryText(ctx, system, history, model, options)
+	if err != nil {
+		return "", err
+	}
+	onChunk(response)
+	return response, nil
+}
@@ -0,0 +1,292 @@
+// Package metrics keeps counters, gauges and histograms and serves them in the
+// Prometheus text exposition format. Packages declare their metrics as package
+// variables, which register them with the process-wide registry.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric types, as named in the exposition format
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of a latency histogram
+var DefaultBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// family is a named metric with one series per combination of label values
+type family interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      = map[string]family{}
+)
+
+// register adds a family to the registry; names must be unique
+func register(f family) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, ok := registry[f.name()]; ok {
+		panic("metrics: duplicate metric " + f.name())
+	}
+	registry[f.name()] = f
+}
+
+// Write writes every registered metric, sorted by name
+func Write(w io.Writer) {
+	registryMutex.Lock()
+	families := make([]family, 0, len(registry))
+	for _, f := range registry {
+		families = append(families, f)
+	}
+	registryMutex.Unlock()
+
+	sort.Slice(families, func(i, j int) bool { return families[i].name() < families[j].name() })
+	for _, f := range families {
+		f.write(w)
+	}
+}
+
+// Handler serves the registered metrics to a Prometheus scraper
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+	})
+}
+
+// desc describes a family: its name, help text, type and label names
+type desc struct {
+	metric string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d *desc) name() string { return d.metric }
+
+// header writes the HELP and TYPE lines of the family
+func (d *desc) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.metric, helpEscaper.Replace(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.metric, d.kind)
+}
+
+// check panics if values do not match the label names
+func (d *desc) check(values []string) {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", d.metric, len(d.labels), len(values)))
+	}
+}
+
+// series writes one sample; extra is an additional label, e.g. a bucket's le
+func (d *desc) series(w io.Writer, suffix string, values []string, extra string, value float64) {
+	var b strings.Builder
+	b.WriteString(d.metric)
+	b.WriteString(suffix)
+	if len(values) > 0 || extra != "" {
+		b.WriteByte('{')
+		for i, v := range values {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, `%s="%s"`, d.labels[i], escaper.Replace(v))
+		}
+		if extra != "" {
+			if len(values) > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(extra)
+		}
+		b.WriteByte('}')
+	}
+	fmt.Fprintf(w, "%s %s\n", b.String(), formatValue(value))
+}
+
+// escaper escapes a label value for the exposition format
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// helpEscaper escapes a help text for the exposition format
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// formatValue formats a sample value
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// key joins label values into a map key
+func key(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// vector keeps the series of a counter or gauge
+type vector struct {
+	desc
+	mutex   sync.Mutex
+	samples map[string]float64
+	values  map[string][]string // label values of each series
+}
+
+func newVector(name, help, kind string, labels []string) *vector {
+	v := &vector{
+		desc:    desc{metric: name, help: help, kind: kind, labels: labels},
+		samples: map[string]float64{},
+		values:  map[string][]string{},
+	}
+	register(v)
+	return v
+}
+
+// add adds delta to the series with the given label values
+func (v *vector) add(delta float64, values []string) {
+	v.check(values)
+	k := key(values)
+	v.mutex.Lock()
+	if _, ok := v.values[k]; !ok {
+		v.values[k] = append([]string(nil), values...)
+	}
+	v.samples[k] += delta
+	v.mutex.Unlock()
+}
+
+func (v *vector) write(w io.Writer) {
+	v.header(w)
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	keys := make([]string, 0, len(v.samples))
+	for k := range v.samples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v.series(w, "", v.values[k], "", v.samples[k])
+	}
+}
+
+// Counter counts events, e.g. turns taken, by its labels
+type Counter struct{ v *vector }
+
+// NewCounter registers a counter with the given label names
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{v: newVector(name, help, typeCounter, labels)}
+}
+
+// Inc adds one to the series with the given label values
+func (c *Counter) Inc(values ...string) {
+	c.v.add(1, values)
+}
+
+// Add adds n, which must not be negative, to the series with the given label values
+func (c *Counter) Add(n float64, values ...string) {
+	if n < 0 {
+		return
+	}
+	c.v.add(n, values)
+}
+
+// Gauge tracks a value that goes up and down, e.g. open connections
+type Gauge struct{ v *vector }
+
+// NewGauge registers a gauge with the given label names
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{v: newVector(name, help, typeGauge, labels)}
+}
+
+// Inc adds one to the series with the given label values
+func (g *Gauge) Inc(values ...string) {
+	g.v.add(1, values)
+}
+
+// Dec subtracts one from the series with the given label values
+func (g *Gauge) Dec(values ...string) {
+	g.v.add(-1, values)
+}
+
+// Histogram samples observations, e.g. latencies, into buckets by its labels
+type Histogram struct {
+	desc
+	buckets []float64
+	mutex   sync.Mutex
+	byKey   map[string]*histogramSeries
+}
+
+// histogramSeries is the histogram of one combination of label values
+type histogramSeries struct {
+	labels []string
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers a histogram with the given bucket upper bounds,
+// in increasing order, and label names
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		desc:    desc{metric: name, help: help, kind: typeHistogram, labels: labels},
+		buckets: buckets,
+		byKey:   map[string]*histogramSeries{},
+	}
+	register(h)
+	return h
+}
+
+// Observe adds an observation to the series with the given label values
+func (h *Histogram) Observe(value float64, values ...string) {
+	h.check(values)
+	k := key(values)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	s, ok := h.byKey[k]
+	if !ok {
+		s = &histogramSeries{labels: append([]string(nil), values...), counts: make([]uint64, len(h.buckets))}
+		h.byKey[k] = s
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.header(w)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	keys := make([]string, 0, len(h.byKey))
+	for k := range h.byKey {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := h.byKey[k]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			h.series(w, "_bucket", s.labels, fmt.Sprintf("le=%q", formatValue(bound)), float64(cumulative))
+		}
+		h.series(w, "_bucket", s.labels, `le="+Inf"`, float64(s.count))
+		h.series(w, "_sum", s.labels, "", s.sum)
+		h.series(w, "_count", s.labels, "", float64(s.count))
+	}
+}
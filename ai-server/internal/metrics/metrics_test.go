@@ -0,0 +1,192 @@
+package metrics
+
+import (
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// isolate gives a test an empty registry, restoring the process-wide one
+// when the test ends, so its metrics can be registered on every run
+func isolate(t *testing.T) {
+	registryMutex.Lock()
+	saved := registry
+	registry = map[string]family{}
+	registryMutex.Unlock()
+	t.Cleanup(func() {
+		registryMutex.Lock()
+		registry = saved
+		registryMutex.Unlock()
+	})
+}
+
+// written returns what a family writes
+func written(f family) string {
+	var b strings.Builder
+	f.write(&b)
+	return b.String()
+}
+
+func TestCounterFormat(t *testing.T) {
+	isolate(t)
+	c := NewCounter("test_counter_total", `Things\counted`+"\nby persona", "persona")
+	c.Inc("alice")
+	c.Add(2.5, "bob")
+	c.Add(-1, "bob") // counters only go up
+	c.Inc(`a"b\c` + "\nd")
+
+	want := `# HELP test_counter_total Things\\counted\nby persona
+# TYPE test_counter_total counter
+test_counter_total{persona="a\"b\\c\nd"} 1
+test_counter_total{persona="alice"} 1
+test_counter_total{persona="bob"} 2.5
+`
+	if got := written(c.v); got != want {
+		t.Errorf("counter written as\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGaugeFormat(t *testing.T) {
+	isolate(t)
+	g := NewGauge("test_gauge", "Open things")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+
+	want := `# HELP test_gauge Open things
+# TYPE test_gauge gauge
+test_gauge 1
+`
+	if got := written(g.v); got != want {
+		t.Errorf("gauge written as\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMultipleLabels(t *testing.T) {
+	isolate(t)
+	c := NewCounter("test_labels_total", "Things by persona and class", "persona", "class")
+	c.Inc("bob", "timeout")
+	c.Inc("alice", "rate_limit")
+	c.Inc("alice", "rate_limit")
+
+	want := `# HELP test_labels_total Things by persona and class
+# TYPE test_labels_total counter
+test_labels_total{persona="alice",class="rate_limit"} 2
+test_labels_total{persona="bob",class="timeout"} 1
+`
+	if got := written(c.v); got != want {
+		t.Errorf("counter written as\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogramFormat(t *testing.T) {
+	isolate(t)
+	h := NewHistogram("test_seconds", "Durations", []float64{0.5, 1}, "persona")
+	h.Observe(0.5, "x") // on a bound, so in its bucket
+	h.Observe(0.75, "x")
+	h.Observe(3, "x") // above every bound, only in +Inf
+	h.Observe(0.25, "y")
+
+	want := `# HELP test_seconds Durations
+# TYPE test_seconds histogram
+test_seconds_bucket{persona="x",le="0.5"} 1
+test_seconds_bucket{persona="x",le="1"} 2
+test_seconds_bucket{persona="x",le="+Inf"} 3
+test_seconds_sum{persona="x"} 4.25
+test_seconds_count{persona="x"} 3
+test_seconds_bucket{persona="y",le="0.5"} 1
+test_seconds_bucket{persona="y",le="1"} 1
+test_seconds_bucket{persona="y",le="+Inf"} 1
+test_seconds_sum{persona="y"} 0.25
+test_seconds_count{persona="y"} 1
+`
+	if got := written(h); got != want {
+		t.Errorf("histogram written as\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogramWithoutLabels(t *testing.T) {
+	isolate(t)
+	h := NewHistogram("test_unlabeled_seconds", "Durations", []float64{1})
+	h.Observe(2)
+
+	want := `# HELP test_unlabeled_seconds Durations
+# TYPE test_unlabeled_seconds histogram
+test_unlabeled_seconds_bucket{le="1"} 0
+test_unlabeled_seconds_bucket{le="+Inf"} 1
+test_unlabeled_seconds_sum 2
+test_unlabeled_seconds_count 1
+`
+	if got := written(h); got != want {
+		t.Errorf("histogram written as\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{0, "0"},
+		{1, "1"},
+		{2.5, "2.5"},
+		{0.1, "0.1"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.Inf(-1), "-Inf"},
+		{math.NaN(), "NaN"},
+	}
+	for _, tt := range tests {
+		if got := formatValue(tt.value); got != tt.want {
+			t.Errorf("formatValue(%v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestWrongLabelCountPanics(t *testing.T) {
+	isolate(t)
+	c := NewCounter("test_checked_total", "Checked things", "persona")
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc with two label values did not panic")
+		}
+	}()
+	c.Inc("alice", "bob")
+}
+
+func TestDuplicatePanics(t *testing.T) {
+	isolate(t)
+	NewGauge("test_duplicate", "Registered once")
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a metric twice did not panic")
+		}
+	}()
+	NewGauge("test_duplicate", "Registered twice")
+}
+
+func TestHandler(t *testing.T) {
+	isolate(t)
+	NewCounter("test_handler_b_total", "Second").Inc()
+	NewCounter("test_handler_a_total", "First").Inc()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the text exposition format", got)
+	}
+	body := rec.Body.String()
+	a := strings.Index(body, "# HELP test_handler_a_total First\n")
+	b := strings.Index(body, "# HELP test_handler_b_total Second\n")
+	if a < 0 || b < 0 {
+		t.Fatalf("metrics missing from\n%s", body)
+	}
+	if a > b {
+		t.Error("metrics are not sorted by name")
+	}
+	if !strings.Contains(body, "\ntest_handler_a_total 1\n") {
+		t.Errorf("sample missing from\n%s", body)
+	}
+}
@@ -0,0 +1,154 @@
+package parser
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrorRoot is the root element of a structured error reply
+const ErrorRoot = "error"
+
+var (
+	// ErrEmpty is returned for output with no text at all
+	ErrEmpty = errors.New("empty output")
+	// ErrMalformed is returned for output that could not be repaired into a reply
+	ErrMalformed = errors.New("malformed output")
+)
+
+// Result is a parsed persona reply
+type Result struct {
+	Root    string      // root element of the reply: the persona tag or "error"
+	Text    string      // display text: the payload, or the content of an error
+	Error   *ErrorReply // set for <error> replies
+	Repairs []string    // repairs applied to the output, empty if it was well-formed
+}
+
+// ErrorReply is the structured error a persona returns when it needs clarification
+type ErrorReply struct {
+	MessageID string `xml:"message_id"`
+	Timestamp string `xml:"timestamp"`
+	Content   string `xml:"content"`
+}
+
+// IsError reports whether the reply is an <error> instead of a payload
+func (r *Result) IsError() bool {
+	return r.Error != nil
+}
+
+// XML returns the reply as well-formed XML, suitable for a conversation context
+func (r *Result) XML() string {
+	var b strings.Builder
+	if r.IsError() {
+		b.WriteString("<error>")
+		writeElement(&b, "message_id", r.Error.MessageID)
+		writeElement(&b, "timestamp", r.Error.Timestamp)
+		writeElement(&b, "content", r.Error.Content)
+		b.WriteString("</error>")
+		return b.String()
+	}
+	writeElement(&b, r.Root, r.Text)
+	return b.String()
+}
+
+// writeElement writes <name>text</name> with text escaped
+func writeElement(b *strings.Builder, name string, text string) {
+	b.WriteString("<" + name + ">")
+	xml.EscapeText(b, []byte(text))
+	b.WriteString("</" + name + ">")
+}
+
+// Parse parses the output of the persona whose replies have the given root
+// element (e.g. "alice"). The payload is the text inside the root, including
+// the text of any child elements such as <response>, with whitespace
+// collapsed. An <error> reply is returned as a Result with Error set.
+// Malformed output is repaired where possible; see Repair.
+func Parse(root string, output string) (*Result, error) {
+	repaired, repairs := Repair(root, output)
+	if strings.TrimSpace(repaired) == "" {
+		return nil, ErrEmpty
+	}
+
+	result, err := decode(root, repaired, true)
+	if err != nil {
+		// let the decoder invent missing end tags of child elements
+		var lenientErr error
+		if result, lenientErr = decode(root, repaired, false); lenientErr != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		repairs = append(repairs, "decoded leniently")
+	}
+	result.Repairs = repairs
+	return result, nil
+}
+
+// decode decodes a single <root> or <error> element
+func decode(root string, data string, strict bool) (*Result, error) {
+	decoder := xml.NewDecoder(strings.NewReader(data))
+	decoder.Strict = strict
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no <%s> or <%s> element", root, ErrorRoot)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case root:
+			text, err := innerText(decoder)
+			if err != nil {
+				return nil, err
+			}
+			return &Result{Root: root, Text: text}, nil
+
+		case ErrorRoot:
+			var reply ErrorReply
+			if err := decoder.DecodeElement(&reply, &start); err != nil {
+				return nil, err
+			}
+			reply.MessageID = collapse(reply.MessageID)
+			reply.Timestamp = collapse(reply.Timestamp)
+			reply.Content = collapse(reply.Content)
+			return &Result{Root: ErrorRoot, Text: reply.Content, Error: &reply}, nil
+
+		default:
+			return nil, fmt.Errorf("unexpected <%s> element", start.Name.Local)
+		}
+	}
+}
+
+// innerText returns the text of the current element and all its children
+func innerText(decoder *xml.Decoder) (string, error) {
+	var b strings.Builder
+	depth := 1
+	for depth > 0 {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			b.WriteString(" ")
+		case xml.EndElement:
+			depth--
+			b.WriteString(" ")
+		case xml.CharData:
+			b.Write(t)
+		}
+	}
+	return collapse(b.String()), nil
+}
+
+// collapse trims text and collapses runs of whitespace into single spaces
+func collapse(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,233 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      string
+		wantRoot    string
+		wantText    string
+		wantError   *ErrorReply
+		wantRepairs []string
+		wantErr     error
+	}{
+		{
+			name:     "well-formed",
+			output:   "<alice>Hello</alice>",
+			wantRoot: "alice",
+			wantText: "Hello",
+		},
+		{
+			name:     "whitespace collapsed",
+			output:   "  <alice>\n  Hello   world\n</alice>  ",
+			wantRoot: "alice",
+			wantText: "Hello world",
+		},
+		{
+			name:     "child elements",
+			output:   "<alice><response>Hello <b>bold</b></response> there</alice>",
+			wantRoot: "alice",
+			wantText: "Hello bold there",
+		},
+		{
+			name:     "nested error element is text",
+			output:   "<alice><error>x</error></alice>",
+			wantRoot: "alice",
+			wantText: "x",
+		},
+		{
+			name:     "empty reply",
+			output:   "<alice></alice>",
+			wantRoot: "alice",
+		},
+		{
+			name:     "first of two replies",
+			output:   "<alice>one</alice><alice>two</alice>",
+			wantRoot: "alice",
+			wantText: "one",
+		},
+		{
+			name:     "entities",
+			output:   "<alice>Fish &amp; chips &lt; 5 &#38; more</alice>",
+			wantRoot: "alice",
+			wantText: "Fish & chips < 5 & more",
+		},
+		{
+			name:      "error reply",
+			output:    "<error><message_id>1</message_id><timestamp>t</timestamp><content> Please   clarify </content></error>",
+			wantRoot:  ErrorRoot,
+			wantText:  "Please clarify",
+			wantError: &ErrorReply{MessageID: "1", Timestamp: "t", Content: "Please clarify"},
+		},
+		{
+			name:        "error reply first",
+			output:      "<error><content>x</content></error><alice>y</alice>",
+			wantRoot:    ErrorRoot,
+			wantText:    "x",
+			wantError:   &ErrorReply{Content: "x"},
+			wantRepairs: []string{"removed text after reply"},
+		},
+		{
+			name:        "code fence",
+			output:      "```xml\n<alice>Hi</alice>\n```",
+			wantRoot:    "alice",
+			wantText:    "Hi",
+			wantRepairs: []string{"removed code fence"},
+		},
+		{
+			name:        "prose around reply",
+			output:      "Sure! <alice>Hi</alice> Hope that helps.",
+			wantRoot:    "alice",
+			wantText:    "Hi",
+			wantRepairs: []string{"removed text before reply", "removed text after reply"},
+		},
+		{
+			name:        "plain text",
+			output:      "Just text & stuff < 3",
+			wantRoot:    "alice",
+			wantText:    "Just text & stuff < 3",
+			wantRepairs: []string{"added missing root element"},
+		},
+		{
+			name:        "stray characters",
+			output:      "<alice>Fish & chips < 5</alice>",
+			wantRoot:    "alice",
+			wantText:    "Fish & chips < 5",
+			wantRepairs: []string{"escaped stray & or <"},
+		},
+		{
+			name:        "missing closing tag",
+			output:      "<alice>Hi",
+			wantRoot:    "alice",
+			wantText:    "Hi",
+			wantRepairs: []string{"added missing </alice>"},
+		},
+		{
+			name:        "truncated closing tag",
+			output:      "<alice>Hi</ali",
+			wantRoot:    "alice",
+			wantText:    "Hi",
+			wantRepairs: []string{"removed truncated tag", "added missing </alice>"},
+		},
+		{
+			name:        "truncated inside a child",
+			output:      "<alice><response>Hi</resp",
+			wantRoot:    "alice",
+			wantText:    "Hi",
+			wantRepairs: []string{"removed truncated tag", "added missing </alice>", "decoded leniently"},
+		},
+		{
+			name:        "truncated after a stray <",
+			output:      "<alice>I <3 you",
+			wantRoot:    "alice",
+			wantText:    "I <3 you",
+			wantRepairs: []string{"added missing </alice>", "escaped stray & or <"},
+		},
+		{
+			name:        "unclosed child",
+			output:      "<alice><response>Hi</alice>",
+			wantRoot:    "alice",
+			wantText:    "Hi",
+			wantRepairs: []string{"decoded leniently"},
+		},
+		{
+			name:    "empty",
+			output:  "",
+			wantErr: ErrEmpty,
+		},
+		{
+			name:    "whitespace",
+			output:  " \n\t",
+			wantErr: ErrEmpty,
+		},
+		{
+			name:    "empty code fence",
+			output:  "```\n```",
+			wantErr: ErrEmpty,
+		},
+		{
+			name:    "another persona's reply",
+			output:  "<bob>wrong persona</bob>",
+			wantErr: ErrMalformed,
+		},
+		{
+			name:    "child without root",
+			output:  "<response>Hi</response>",
+			wantErr: ErrMalformed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Parse("alice", tt.output)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Parse error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if result.Root != tt.wantRoot || result.Text != tt.wantText {
+				t.Errorf("Parse = <%s>%q, want <%s>%q", result.Root, result.Text, tt.wantRoot, tt.wantText)
+			}
+			if !reflect.DeepEqual(result.Error, tt.wantError) {
+				t.Errorf("Error = %+v, want %+v", result.Error, tt.wantError)
+			}
+			if result.IsError() != (tt.wantError != nil) {
+				t.Errorf("IsError = %v", result.IsError())
+			}
+			if len(result.Repairs) != 0 || len(tt.wantRepairs) != 0 {
+				if !reflect.DeepEqual(result.Repairs, tt.wantRepairs) {
+					t.Errorf("Repairs = %q, want %q", result.Repairs, tt.wantRepairs)
+				}
+			}
+		})
+	}
+}
+
+func TestResultXML(t *testing.T) {
+	tests := []struct {
+		name   string
+		result Result
+		want   string
+	}{
+		{
+			name:   "payload",
+			result: Result{Root: "bob", Text: "Why?"},
+			want:   "<bob>Why?</bob>",
+		},
+		{
+			name:   "escaped payload",
+			result: Result{Root: "bob", Text: `Fish & chips < "5"`},
+			want:   "<bob>Fish &amp; chips &lt; &#34;5&#34;</bob>",
+		},
+		{
+			name:   "error",
+			result: Result{Root: ErrorRoot, Text: "Huh?", Error: &ErrorReply{MessageID: "7", Timestamp: "now", Content: "Huh?"}},
+			want:   "<error><message_id>7</message_id><timestamp>now</timestamp><content>Huh?</content></error>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.result.XML()
+			if got != tt.want {
+				t.Fatalf("XML = %q, want %q", got, tt.want)
+			}
+
+			// the XML parses back into the same reply
+			parsed, err := Parse("bob", got)
+			if err != nil {
+				t.Fatalf("Parse(XML): %v", err)
+			}
+			if parsed.Text != tt.result.Text || !reflect.DeepEqual(parsed.Error, tt.result.Error) || len(parsed.Repairs) != 0 {
+				t.Errorf("Parse(XML) = %+v, want %+v", parsed, tt.result)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+// fence matches a Markdown code fence line such as ``` or ```xml
+var fence = regexp.MustCompile("(?m)^[ \t]*```[A-Za-z]*[ \t]*$")
+
+// entity matches the XML entity or character reference at the start of a string
+var entity = regexp.MustCompile(`^&(amp|lt|gt|quot|apos|#[0-9]+|#x[0-9A-Fa-f]+);`)
+
+// Repair fixes the common ways models break the XML reply format: code
+// fences around the reply, prose before or after it, unescaped '&' and '<'
+// in the text, a truncated closing tag, and a bare reply with no tags at all.
+// It returns the repaired output and a description of each repair made.
+func Repair(root string, output string) (string, []string) {
+	var repairs []string
+	text := strings.TrimSpace(output)
+
+	if fence.MatchString(text) {
+		text = strings.TrimSpace(fence.ReplaceAllString(text, ""))
+		repairs = append(repairs, "removed code fence")
+	}
+
+	// no markup at all: the model answered in plain text
+	if !hasMarkup(text) {
+		if text == "" {
+			return "", repairs
+		}
+		return "<" + root + ">" + escape(text) + "</" + root + ">", append(repairs, "added missing root element")
+	}
+
+	// drop prose around the reply element
+	tag := root
+	start := strings.Index(text, "<"+root+">")
+	if errStart := strings.Index(text, "<"+ErrorRoot+">"); errStart >= 0 && (start < 0 || errStart < start) {
+		tag, start = ErrorRoot, errStart
+	}
+	if start > 0 {
+		text = text[start:]
+		repairs = append(repairs, "removed text before reply")
+	}
+	closing := "</" + tag + ">"
+	if end := strings.LastIndex(text, closing); end >= 0 {
+		if end+len(closing) < len(text) {
+			text = text[:end+len(closing)]
+			repairs = append(repairs, "removed text after reply")
+		}
+	} else if start >= 0 {
+		// the output was cut off, possibly inside a tag
+		if i := strings.LastIndex(text, "<"); i > strings.LastIndex(text, ">") && startsMarkup(text[i+1:]) {
+			text = text[:i]
+			repairs = append(repairs, "removed truncated tag")
+		}
+		text += closing
+		repairs = append(repairs, "added missing "+closing)
+	}
+
+	if fixed := escapeStray(text); fixed != text {
+		text = fixed
+		repairs = append(repairs, "escaped stray & or <")
+	}
+
+	return text, repairs
+}
+
+// escapeStray escapes '&' not starting an entity and '<' not starting markup
+func escapeStray(text string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '&' && !entity.MatchString(text[i:]):
+			b.WriteString("&amp;")
+		case c == '<' && !startsMarkup(text[i+1:]):
+			b.WriteString("&lt;")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// hasMarkup reports whether text contains a '<' that starts markup
+func hasMarkup(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if text[i] == '<' && startsMarkup(text[i+1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// startsMarkup reports whether the text after a '<' begins a tag, comment,
+// CDATA section or processing instruction
+func startsMarkup(rest string) bool {
+	if rest == "" {
+		return false
+	}
+	c := rest[0]
+	return c == '/' || c == '!' || c == '?' || c == '_' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// escape escapes the XML special characters in plain text
+func escape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
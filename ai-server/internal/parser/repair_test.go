@@ -0,0 +1,140 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRepair(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      string
+		want        string
+		wantRepairs []string
+	}{
+		{
+			name:   "well-formed",
+			output: "<bob>Why?</bob>",
+			want:   "<bob>Why?</bob>",
+		},
+		{
+			name:   "surrounding whitespace",
+			output: "\n  <bob>Why?</bob>\n",
+			want:   "<bob>Why?</bob>",
+		},
+		{
+			name:        "code fence",
+			output:      "```xml\n<bob>Why?</bob>\n```",
+			want:        "<bob>Why?</bob>",
+			wantRepairs: []string{"removed code fence"},
+		},
+		{
+			name:        "plain text",
+			output:      "Why is 5 > 3 & 2 < 4?",
+			want:        "<bob>Why is 5 &gt; 3 &amp; 2 &lt; 4?</bob>",
+			wantRepairs: []string{"added missing root element"},
+		},
+		{
+			name:        "plain text in a code fence",
+			output:      "```\nWhy?\n```",
+			want:        "<bob>Why?</bob>",
+			wantRepairs: []string{"removed code fence", "added missing root element"},
+		},
+		{
+			name:        "text before",
+			output:      "Here is my question: <bob>Why?</bob>",
+			want:        "<bob>Why?</bob>",
+			wantRepairs: []string{"removed text before reply"},
+		},
+		{
+			name:        "text after",
+			output:      "<bob>Why?</bob>\nLet me know!",
+			want:        "<bob>Why?</bob>",
+			wantRepairs: []string{"removed text after reply"},
+		},
+		{
+			name:        "error before reply",
+			output:      "Hmm <error><content>Huh?</content></error> <bob>Why?</bob>",
+			want:        "<error><content>Huh?</content></error>",
+			wantRepairs: []string{"removed text before reply", "removed text after reply"},
+		},
+		{
+			name:        "missing closing tag",
+			output:      "<bob>Why?",
+			want:        "<bob>Why?</bob>",
+			wantRepairs: []string{"added missing </bob>"},
+		},
+		{
+			name:        "truncated closing tag",
+			output:      "<bob>Why?</b",
+			want:        "<bob>Why?</bob>",
+			wantRepairs: []string{"removed truncated tag", "added missing </bob>"},
+		},
+		{
+			name:        "truncated opening tag",
+			output:      "<bob><resp",
+			want:        "<bob></bob>",
+			wantRepairs: []string{"removed truncated tag", "added missing </bob>"},
+		},
+		{
+			name:        "stray characters",
+			output:      "<bob>Is 2 < 3 & 4 > 3?</bob>",
+			want:        "<bob>Is 2 &lt; 3 &amp; 4 > 3?</bob>",
+			wantRepairs: []string{"escaped stray & or <"},
+		},
+		{
+			name:   "entities kept",
+			output: "<bob>&amp; &lt; &gt; &quot; &apos; &#38; &#x26;</bob>",
+			want:   "<bob>&amp; &lt; &gt; &quot; &apos; &#38; &#x26;</bob>",
+		},
+		{
+			name:   "markup kept",
+			output: "<bob><!-- note --><![CDATA[x]]></bob>",
+			want:   "<bob><!-- note --><![CDATA[x]]></bob>",
+		},
+		{
+			name:   "no reply element",
+			output: "<response>Why?</response>",
+			want:   "<response>Why?</response>",
+		},
+		{
+			name:   "empty",
+			output: "   ",
+			want:   "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, repairs := Repair("bob", tt.output)
+			if got != tt.want {
+				t.Errorf("Repair = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(repairs, tt.wantRepairs) {
+				t.Errorf("repairs = %q, want %q", repairs, tt.wantRepairs)
+			}
+		})
+	}
+}
+
+func TestStartsMarkup(t *testing.T) {
+	tests := []struct {
+		rest string
+		want bool
+	}{
+		{"", false},
+		{"bob>", true},
+		{"Bob>", true},
+		{"/bob>", true},
+		{"!-- -->", true},
+		{"?xml?>", true},
+		{"_x>", true},
+		{"3", false},
+		{" b", false},
+		{"=", false},
+	}
+	for _, tt := range tests {
+		if got := startsMarkup(tt.rest); got != tt.want {
+			t.Errorf("startsMarkup(%q) = %v, want %v", tt.rest, got, tt.want)
+		}
+	}
+}
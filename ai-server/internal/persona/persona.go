@@ -0,0 +1,183 @@
+package persona
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/llm"
+	"github.com/dmh2000/ai-server/internal/parser"
+	"github.com/dmh2000/ai-server/internal/prompt"
+)
+
+// Role is the part a persona plays in a conversation
+type Role string
+
+// Roles
+const (
+	Asker    Role = "asker"    // takes the operator's question and asks follow-ups
+	Answerer Role = "answerer" // answers the asker's questions
+
+	// Roles at a round table, which any persona can join
+	Panelist  Role = "panelist"  // takes turns with the other personas
+	Moderator Role = "moderator" // hosts the table for the operator; not played by a persona
+)
+
+// ModeratorName is the speaker and XML root tag of the operator's messages in
+// a persona's history, so no persona may use it
+const ModeratorName = "moderator"
+
+var (
+	// ErrUnknown is returned for a persona name that is not registered
+	ErrUnknown = errors.New("unknown persona")
+	// ErrWrongRole is returned when a persona is asked to play a role it is not defined for
+	ErrWrongRole = errors.New("persona has the wrong role")
+	// ErrPanel is returned for a round table with too few or repeated personas
+	ErrPanel = errors.New("a round table needs two or more different personas")
+)
+
+// validName matches persona names and XML root tags
+var validName = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// Persona defines a character that can take part in a conversation
+type Persona struct {
+	Name        string // unique identifier, e.g. "alice"; names its prompt file, transcript turns and audio
+	DisplayName string // shown to users, e.g. "Alice"
+	Root        string // XML root tag of its replies, e.g. "alice"
+	Role        Role
+	Prompt      string // system prompt, used unless a prompt directory overrides it
+	Provider    string // provider name or "fake"
+	Settings    llm.Settings
+	Timeout     time.Duration // limit of each query attempt, 0 for none
+	Voice       string        // TTS voice, "" for the engine default
+}
+
+// validate checks the definition and fills in defaults
+func (p *Persona) validate() error {
+	if !validName.MatchString(p.Name) || p.Name == ModeratorName {
+		return fmt.Errorf("invalid persona name %q", p.Name)
+	}
+	if p.Root == "" {
+		p.Root = p.Name
+	}
+	if !validName.MatchString(p.Root) || p.Root == parser.ErrorRoot || p.Root == ModeratorName {
+		return fmt.Errorf("persona %s: invalid root tag %q", p.Name, p.Root)
+	}
+	if p.DisplayName == "" {
+		p.DisplayName = strings.ToUpper(p.Name[:1]) + p.Name[1:]
+	}
+	if p.Role != Asker && p.Role != Answerer {
+		return fmt.Errorf("persona %s: role must be %q or %q, not %q", p.Name, Asker, Answerer, p.Role)
+	}
+	if err := prompt.Validate(p.Root, p.Prompt); err != nil {
+		return fmt.Errorf("persona %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+// Pair is the two personas of a conversation
+type Pair struct {
+	Asker    *Persona
+	Answerer *Persona
+}
+
+// Get returns the persona of the pair with the given name, or nil
+func (p Pair) Get(name string) *Persona {
+	switch name {
+	case p.Asker.Name:
+		return p.Asker
+	case p.Answerer.Name:
+		return p.Answerer
+	}
+	return nil
+}
+
+// Registry holds the configured personas
+type Registry struct {
+	personas map[string]*Persona
+}
+
+// NewRegistry validates the persona definitions and creates a registry of them
+func NewRegistry(personas []*Persona) (*Registry, error) {
+	r := &Registry{personas: map[string]*Persona{}}
+	for _, p := range personas {
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := r.personas[p.Name]; ok {
+			return nil, fmt.Errorf("duplicate persona %s", p.Name)
+		}
+		r.personas[p.Name] = p
+	}
+	return r, nil
+}
+
+// Get returns the persona with the given name
+func (r *Registry) Get(name string) (*Persona, error) {
+	p, ok := r.personas[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknown, name)
+	}
+	return p, nil
+}
+
+// All returns every persona, sorted by name
+func (r *Registry) All() []*Persona {
+	personas := make([]*Persona, 0, len(r.personas))
+	for _, p := range r.personas {
+		personas = append(personas, p)
+	}
+	sort.Slice(personas, func(i, j int) bool { return personas[i].Name < personas[j].Name })
+	return personas
+}
+
+// Pair returns the personas with the given names, checking that they play
+// the asker and answerer roles
+func (r *Registry) Pair(asker string, answerer string) (Pair, error) {
+	a, err := r.get(asker, Asker)
+	if err != nil {
+		return Pair{}, err
+	}
+	b, err := r.get(answerer, Answerer)
+	if err != nil {
+		return Pair{}, err
+	}
+	return Pair{Asker: a, Answerer: b}, nil
+}
+
+// Panel returns the personas with the given names for a round table, where
+// they may play any role
+func (r *Registry) Panel(names []string) ([]*Persona, error) {
+	if len(names) < 2 {
+		return nil, ErrPanel
+	}
+	panel := make([]*Persona, 0, len(names))
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			return nil, fmt.Errorf("%w: %s is repeated", ErrPanel, name)
+		}
+		seen[name] = true
+		p, err := r.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		panel = append(panel, p)
+	}
+	return panel, nil
+}
+
+// get returns the named persona if it plays the given role
+func (r *Registry) get(name string, role Role) (*Persona, error) {
+	p, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if p.Role != role {
+		return nil, fmt.Errorf("%w: %s is an %s, not an %s", ErrWrongRole, name, p.Role, role)
+	}
+	return p, nil
+}
@@ -0,0 +1,166 @@
+package prompt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/logger"
+)
+
+// maxPromptSize bounds a prompt file so a stray large file cannot blow the
+// context window of every turn
+const maxPromptSize = 64 * 1024
+
+// FileName returns the name of a persona's prompt file, e.g. "alice-system.md"
+func FileName(persona string) string {
+	return persona + "-system.md"
+}
+
+// Persona is a persona whose prompt a Store serves
+type Persona struct {
+	Name     string // names the prompt file
+	Root     string // XML root tag the prompt must describe
+	Fallback string // built-in prompt
+}
+
+// Store serves the personas' system prompts from a directory, reloading
+// files when they change. Personas whose file is missing or invalid get
+// their fallback prompt, or keep the last valid one after an edit.
+type Store struct {
+	dir      string
+	personas map[string]Persona
+
+	mutex   sync.RWMutex
+	prompts map[string]string    // persona -> prompt loaded from dir
+	loaded  map[string]time.Time // persona -> modification time of the loaded file
+}
+
+// NewStore creates a store for the personas' prompt files in dir and loads them
+func NewStore(dir string, personas []Persona) *Store {
+	s := &Store{
+		dir:      dir,
+		personas: map[string]Persona{},
+		prompts:  map[string]string{},
+		loaded:   map[string]time.Time{},
+	}
+	for _, p := range personas {
+		s.personas[p.Name] = p
+	}
+	s.reload()
+	return s
+}
+
+// Prompt returns the current system prompt of a persona
+func (s *Store) Prompt(persona string) string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if prompt, ok := s.prompts[persona]; ok {
+		return prompt
+	}
+	return s.personas[persona].Fallback
+}
+
+// Watch polls the directory every interval and reloads changed prompt
+// files until ctx is done
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.reload()
+		}
+	}
+}
+
+// reload loads each persona's prompt file if it changed since the last load
+func (s *Store) reload() {
+	for persona, p := range s.personas {
+		path := filepath.Join(s.dir, FileName(persona))
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			s.remove(persona, path)
+			continue
+		}
+		if err != nil {
+			logger.Printf("Prompt %s: %v", path, err)
+			continue
+		}
+
+		s.mutex.RLock()
+		loaded, ok := s.loaded[persona]
+		s.mutex.RUnlock()
+		if ok && info.ModTime().Equal(loaded) {
+			continue
+		}
+
+		prompt, err := load(p.Root, path, info)
+		s.mutex.Lock()
+		// remember the attempt so an invalid file is not reported every poll
+		s.loaded[persona] = info.ModTime()
+		if err == nil {
+			s.prompts[persona] = prompt
+		}
+		s.mutex.Unlock()
+
+		if err != nil {
+			logger.Printf("Prompt %s is invalid, keeping the current %s prompt: %v", path, persona, err)
+			continue
+		}
+		logger.Printf("Loaded %s prompt from %s", persona, path)
+	}
+}
+
+// remove reverts a persona whose prompt file was deleted to its fallback
+func (s *Store) remove(persona string, path string) {
+	s.mutex.Lock()
+	_, ok := s.loaded[persona]
+	delete(s.prompts, persona)
+	delete(s.loaded, persona)
+	s.mutex.Unlock()
+
+	if ok {
+		logger.Printf("Prompt %s removed, using the built-in %s prompt", path, persona)
+	}
+}
+
+// load reads and validates a prompt file
+func load(root string, path string, info os.FileInfo) (string, error) {
+	if info.Size() > maxPromptSize {
+		return "", fmt.Errorf("larger than %d bytes", maxPromptSize)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	prompt := string(data)
+	if err := Validate(root, prompt); err != nil {
+		return "", err
+	}
+	return prompt, nil
+}
+
+// Validate checks that a prompt can drive a persona: it is not empty, it
+// describes the persona's XML root tag, which the reply parser relies on,
+// and its <SystemPrompt> wrapper, if any, is closed
+func Validate(root string, prompt string) error {
+	if strings.TrimSpace(prompt) == "" {
+		return errors.New("prompt is empty")
+	}
+	if !strings.Contains(prompt, "<"+root+">") {
+		return fmt.Errorf("prompt does not mention the <%s> root tag", root)
+	}
+	if strings.Contains(prompt, "<SystemPrompt>") && !strings.Contains(prompt, "</SystemPrompt>") {
+		return errors.New("prompt has no closing </SystemPrompt>")
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/dmh2000/ai-server/internal/logger"
+	"github.com/dmh2000/ai-server/internal/metrics"
+	"github.com/dmh2000/ai-server/internal/transcript"
+)
+
+// HTTPServer is the single HTTP server of the AI server. It hosts the persona
+// WebSocket endpoints, the transcript endpoints, health checks and optionally
+// the built web clients, so no reverse proxy or separate static server is needed.
+type HTTPServer struct {
+	addr  string
+	mux   *http.ServeMux
+	ready atomic.Bool
+}
+
+// NewHTTPServer creates the server with its health and debug endpoints:
+//
+//	GET /healthz     200 while the process is running
+//	GET /readyz      200 while accepting connections, 503 before start and during shutdown
+//	GET /metrics     conversation, model and connection metrics for Prometheus
+func NewHTTPServer(host string, port int) *HTTPServer {
+	h := &HTTPServer{
+		addr: fmt.Sprintf("%s:%d", host, port),
+		mux:  http.NewServeMux(),
+	}
+
+	h.mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	h.mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !h.ready.Load() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ready")
+	})
+	h.mux.Handle("GET /metrics", metrics.Handler())
+
+	return h
+}
+
+// Handle registers a handler, e.g. a persona Server on its WebSocket path
+func (h *HTTPServer) Handle(pattern string, handler http.Handler) {
+	h.mux.Handle(pattern, handler)
+}
+
+// HandleTranscripts registers the stored conversation endpoints
+func (h *HTTPServer) HandleTranscripts(store *transcript.Store) {
+	handleTranscripts(h.mux, store)
+}
+
+// HandleStatic serves the files in dir (a built web client) under prefix, e.g. "/alice/"
+func (h *HTTPServer) HandleStatic(prefix string, dir string) {
+	files := http.StripPrefix(prefix, http.FileServer(http.Dir(dir)))
+	h.mux.Handle("GET "+prefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// always fetch the latest build
+		w.Header().Set("Cache-Control", "no-cache")
+		files.ServeHTTP(w, r)
+	}))
+	logger.Printf("Serving %s from %s", prefix, dir)
+}
+
+// Start begins listening and serving until ctx is done
+func (h *HTTPServer) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", h.addr)
+	if err != nil {
+		return err
+	}
+	logger.Printf("HTTP server listening on %s", h.addr)
+
+	server := &http.Server{
+		Handler: h.mux,
+	}
+
+	// Handle graceful shutdown
+	go func() {
+		<-ctx.Done()
+		h.ready.Store(false)
+		logger.Println("Shutting down HTTP server...")
+		server.Close()
+	}()
+
+	h.ready.Store(true)
+	err = server.Serve(listener)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
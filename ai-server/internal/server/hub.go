@@ -0,0 +1,136 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/logger"
+	"github.com/dmh2000/ai-server/internal/types"
+	"github.com/gorilla/websocket"
+)
+
+// writeTimeout bounds a single WebSocket write so a stalled client cannot block its queue forever
+const writeTimeout = 10 * time.Second
+
+// subscriber is one WebSocket client with its own write queue
+type subscriber struct {
+	conn      *websocket.Conn
+	send      chan types.ConversationMessage
+	closeOnce sync.Once
+}
+
+// hub fans out messages to every WebSocket client watching a conversation.
+// Each client has its own write queue drained by a dedicated goroutine, so a
+// slow client is disconnected instead of delaying or dropping messages for the others.
+type hub struct {
+	name        string
+	queueSize   int
+	mutex       sync.Mutex
+	subscribers map[*subscriber]struct{}
+}
+
+// newHub creates a hub; name is used in log messages
+func newHub(name string, queueSize int) *hub {
+	return &hub{
+		name:        name,
+		queueSize:   queueSize,
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+// Subscribe adds a connection to the hub and starts its writer
+func (h *hub) Subscribe(conn *websocket.Conn) *subscriber {
+	sub := &subscriber{
+		conn: conn,
+		send: make(chan types.ConversationMessage, h.queueSize),
+	}
+
+	h.mutex.Lock()
+	h.subscribers[sub] = struct{}{}
+	count := len(h.subscribers)
+	h.mutex.Unlock()
+
+	go sub.writePump()
+
+	logger.Printf("%s: client subscribed (%d connected)", h.name, count)
+	return sub
+}
+
+// Unsubscribe removes a connection from the hub and closes it. It is safe to
+// call more than once.
+func (h *hub) Unsubscribe(sub *subscriber) {
+	h.mutex.Lock()
+	_, ok := h.subscribers[sub]
+	delete(h.subscribers, sub)
+	count := len(h.subscribers)
+	h.mutex.Unlock()
+
+	sub.close()
+	if ok {
+		logger.Printf("%s: client unsubscribed (%d connected)", h.name, count)
+	}
+}
+
+// Broadcast queues msg for every connected client. Clients whose queue is full
+// are disconnected; the message is still delivered to everyone else.
+func (h *hub) Broadcast(msg types.ConversationMessage) {
+	h.mutex.Lock()
+	if len(h.subscribers) == 0 {
+		h.mutex.Unlock()
+		logger.Printf("%s: no clients connected, message dropped", h.name)
+		return
+	}
+	var slow []*subscriber
+	for sub := range h.subscribers {
+		select {
+		case sub.send <- msg:
+		default:
+			slow = append(slow, sub)
+		}
+	}
+	h.mutex.Unlock()
+
+	for _, sub := range slow {
+		logger.Printf("%s: client write queue full, disconnecting slow client", h.name)
+		h.Unsubscribe(sub)
+	}
+}
+
+// Send queues msg for a single client. It returns false if the client's queue is full.
+func (h *hub) Send(sub *subscriber, msg types.ConversationMessage) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if _, ok := h.subscribers[sub]; !ok {
+		return false
+	}
+	select {
+	case sub.send <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// writePump writes queued messages to the connection until the queue is closed
+func (sub *subscriber) writePump() {
+	for msg := range sub.send {
+		sub.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err := sub.conn.WriteJSON(msg); err != nil {
+			logger.Printf("Failed to send message to client: %v", err)
+			// closing the connection ends the client's read loop, which unsubscribes it
+			sub.conn.Close()
+			break
+		}
+	}
+	// drain anything queued after a failed write
+	for range sub.send {
+	}
+}
+
+// close closes the write queue and the connection
+func (sub *subscriber) close() {
+	sub.closeOnce.Do(func() {
+		close(sub.send)
+		sub.conn.Close()
+	})
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/types"
+	"github.com/gorilla/websocket"
+)
+
+// connect returns the server and client ends of a WebSocket connection
+func connect(t *testing.T) (*websocket.Conn, *websocket.Conn) {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Upgrade: %v", err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	conn := <-conns
+	t.Cleanup(func() { conn.Close() })
+	return conn, client
+}
+
+// read returns the next message a client receives
+func read(t *testing.T, client *websocket.Conn) (types.ConversationMessage, error) {
+	t.Helper()
+	var msg types.ConversationMessage
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	err := client.ReadJSON(&msg)
+	return msg, err
+}
+
+// subscribeStalled adds a client whose writer is not running, so its queue
+// fills up as if its connection had stalled
+func subscribeStalled(h *hub, conn *websocket.Conn) *subscriber {
+	sub := &subscriber{conn: conn, send: make(chan types.ConversationMessage, h.queueSize)}
+	h.mutex.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mutex.Unlock()
+	return sub
+}
+
+// subscribed reports whether sub is connected to the hub
+func subscribed(h *hub, sub *subscriber) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	_, ok := h.subscribers[sub]
+	return ok
+}
+
+func TestBroadcast(t *testing.T) {
+	h := newHub("test", 4)
+	var clients []*websocket.Conn
+	for range 2 {
+		conn, client := connect(t)
+		h.Subscribe(conn)
+		clients = append(clients, client)
+	}
+
+	h.Broadcast(types.ConversationMessage{Text: "one"})
+	h.Broadcast(types.ConversationMessage{Text: "two"})
+	for i, client := range clients {
+		for _, want := range []string{"one", "two"} {
+			msg, err := read(t, client)
+			if err != nil {
+				t.Fatalf("client %d: %v", i, err)
+			}
+			if msg.Text != want {
+				t.Errorf("client %d received %q, want %q", i, msg.Text, want)
+			}
+		}
+	}
+}
+
+func TestBroadcastEvictsSlowClient(t *testing.T) {
+	h := newHub("test", 1)
+	slowConn, slowClient := connect(t)
+	fastConn, _ := connect(t)
+	slow := subscribeStalled(h, slowConn)
+	fast := subscribeStalled(h, fastConn)
+
+	// the slow client has not taken its last message yet
+	slow.send <- types.ConversationMessage{Text: "earlier"}
+
+	h.Broadcast(types.ConversationMessage{Text: "next"})
+	if subscribed(h, slow) {
+		t.Error("the slow client is still subscribed")
+	}
+	if !subscribed(h, fast) {
+		t.Fatal("the client with room was disconnected")
+	}
+	if msg := <-fast.send; msg.Text != "next" {
+		t.Errorf("queued %q for the client with room, want next", msg.Text)
+	}
+
+	// the slow client's connection was closed
+	if _, err := read(t, slowClient); err == nil {
+		t.Error("the slow client's connection is still open")
+	}
+}
+
+func TestSend(t *testing.T) {
+	h := newHub("test", 1)
+	conn, _ := connect(t)
+	sub := subscribeStalled(h, conn)
+
+	if !h.Send(sub, types.ConversationMessage{Text: "one"}) {
+		t.Error("Send to a client with room failed")
+	}
+	if h.Send(sub, types.ConversationMessage{Text: "two"}) {
+		t.Error("Send to a full queue succeeded")
+	}
+	if !subscribed(h, sub) {
+		t.Error("Send disconnected the client")
+	}
+
+	h.Unsubscribe(sub)
+	h.Unsubscribe(sub)
+	if h.Send(sub, types.ConversationMessage{Text: "three"}) {
+		t.Error("Send to an unsubscribed client succeeded")
+	}
+}
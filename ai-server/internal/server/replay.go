@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/logger"
+	"github.com/dmh2000/ai-server/internal/persona"
+	"github.com/dmh2000/ai-server/internal/transcript"
+	"github.com/dmh2000/ai-server/internal/types"
+)
+
+// handleTranscripts registers the stored conversation endpoints:
+//
+//	GET /conversations       summaries of all stored transcripts
+//	GET /conversations/{id}  every turn of one transcript
+func handleTranscripts(mux *http.ServeMux, store *transcript.Store) {
+	mux.HandleFunc("GET /conversations", func(w http.ResponseWriter, r *http.Request) {
+		summaries, err := store.List()
+		if err != nil {
+			logger.Printf("Failed to list transcripts: %v", err)
+			http.Error(w, "failed to list conversations", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, summaries)
+	})
+
+	mux.HandleFunc("GET /conversations/{id}", func(w http.ResponseWriter, r *http.Request) {
+		turns, err := store.Load(r.PathValue("id"))
+		if errors.Is(err, transcript.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Printf("Failed to load transcript: %v", err)
+			http.Error(w, "failed to load conversation", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, turns)
+	})
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Printf("Failed to write response: %v", err)
+	}
+}
+
+// serveReplay replays a stored transcript to a WebSocket client instead of
+// joining a live conversation. Only the turns of the persona that played the
+// given role are sent, or every turn for the moderator, one every interval,
+// followed by a conversation_end with reason replay_complete.
+func serveReplay(w http.ResponseWriter, r *http.Request, store *transcript.Store, id string, role persona.Role, interval time.Duration) {
+	if store == nil {
+		http.Error(w, "transcripts are disabled", http.StatusNotFound)
+		return
+	}
+	turns, err := store.Load(id)
+	if errors.Is(err, transcript.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Printf("Failed to load transcript: %v", err)
+		http.Error(w, "failed to load conversation", http.StatusInternalServerError)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Printf("Failed to upgrade connection: %v", err)
+		return
+	}
+	defer conn.Close()
+	logger.Printf("Replaying %s to %s client", id, role)
+
+	// Read (and ignore) client messages so we notice when it disconnects
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// every turn is recorded with the role of its speaker; a pair's clients
+	// replay their own side, a round table's every turn
+	for _, turn := range turns {
+		if role != persona.Moderator && persona.Role(turn.Role) != role {
+			continue
+		}
+		if err := conn.WriteJSON(types.ConversationMessage{Text: turn.Text, Speaker: turn.Speaker}); err != nil {
+			logger.Printf("Failed to send replay message: %v", err)
+			return
+		}
+		select {
+		case <-done:
+			return
+		case <-time.After(interval):
+		}
+	}
+
+	endMsg := types.ConversationMessage{
+		Type:   types.MessageTypeConversationEnd,
+		Text:   "End of replay.",
+		Reason: types.EndReasonReplayComplete,
+	}
+	if err := conn.WriteJSON(endMsg); err != nil {
+		logger.Printf("Failed to send replay end: %v", err)
+		return
+	}
+
+	// Keep the connection open until the client leaves
+	<-done
+}
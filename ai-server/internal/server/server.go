@@ -0,0 +1,319 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/ai"
+	"github.com/dmh2000/ai-server/internal/delivery"
+	"github.com/dmh2000/ai-server/internal/logger"
+	"github.com/dmh2000/ai-server/internal/metrics"
+	"github.com/dmh2000/ai-server/internal/persona"
+	"github.com/dmh2000/ai-server/internal/session"
+	"github.com/dmh2000/ai-server/internal/transcript"
+	"github.com/dmh2000/ai-server/internal/types"
+	"github.com/gorilla/websocket"
+)
+
+// connections counts the clients of live conversations, served at /metrics
+var connections = metrics.NewGauge("websocket_connections", "Connected WebSocket clients of live conversations, by side", "side")
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		// Allow all origins for development
+		return true
+	},
+}
+
+// Resettable interface for AI components
+type Resettable interface {
+	Reset()
+}
+
+// InboundPolicy decides what a server does with text sent by its clients
+type InboundPolicy int
+
+const (
+	// ForwardToAI passes client text to the persona's AI
+	ForwardToAI InboundPolicy = iota
+	// EchoAndForward broadcasts client text to every client of the
+	// conversation, then passes it to the persona's AI
+	EchoAndForward
+)
+
+// Role describes the side of the conversation a Server serves
+type Role struct {
+	Name    string       // name used in log messages
+	Side    persona.Role // whichever persona plays this role in a conversation
+	Inbound InboundPolicy
+	Steers  bool // clients may steer the conversation with operator messages
+}
+
+var (
+	// AnswererRole serves the answerer clients, which mostly receive
+	AnswererRole = Role{Name: "Answerer", Side: persona.Answerer, Inbound: ForwardToAI}
+	// AskerRole serves the asker clients, whose text starts a new conversation
+	AskerRole = Role{Name: "Asker", Side: persona.Asker, Inbound: EchoAndForward, Steers: true}
+	// ModeratorRole serves the round-table clients; the moderator echoes
+	// their text itself, marked with the moderator as speaker
+	ModeratorRole = Role{Name: "Round table", Side: persona.Moderator, Inbound: ForwardToAI}
+)
+
+// Options configures the WebSocket servers
+type Options struct {
+	QueueSize      int               // messages buffered per client before it is considered too slow
+	Transcripts    *transcript.Store // nil disables replay
+	ReplayInterval time.Duration     // pause between replayed messages
+}
+
+// Server manages WebSocket connections for one persona's clients.
+// It is an http.Handler mounted on the WebSocket endpoint of its persona.
+type Server struct {
+	role     Role
+	opts     Options
+	sessions *session.Manager
+	hubs     map[*session.Session]*hub // connected clients per session
+	hubMutex sync.Mutex
+}
+
+// New creates a WebSocket server for a persona
+func New(role Role, sessions *session.Manager, opts Options) *Server {
+	s := &Server{
+		role:     role,
+		opts:     opts,
+		sessions: sessions,
+		hubs:     make(map[*session.Session]*hub),
+	}
+	// Broadcast each conversation's AI messages to its clients
+	sessions.OnSessionStart(s.broadcastFromAI)
+	return s
+}
+
+// hub returns the hub for a session, creating it if needed. Hubs belong to a
+// session rather than its conversation ID, so a session started for the ID
+// while an idle one is still closing gets a hub of its own. A closed session's
+// hub is not kept, since nothing would remove it.
+func (s *Server) hub(sess *session.Session) *hub {
+	s.hubMutex.Lock()
+	defer s.hubMutex.Unlock()
+	h, ok := s.hubs[sess]
+	if !ok {
+		h = newHub(s.role.Name+" "+sess.ID, s.opts.QueueSize)
+		if sess.Context().Err() == nil {
+			s.hubs[sess] = h
+		}
+	}
+	return h
+}
+
+// removeHub forgets a session's hub once the session has closed
+func (s *Server) removeHub(sess *session.Session) {
+	s.hubMutex.Lock()
+	defer s.hubMutex.Unlock()
+	delete(s.hubs, sess)
+}
+
+// ServeHTTP handles incoming WebSocket connections
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Replay a stored conversation instead of joining a live one
+	if id := r.URL.Query().Get("replay"); id != "" {
+		serveReplay(w, r, s.opts.Transcripts, id, s.role.Side, s.opts.ReplayInterval)
+		return
+	}
+
+	// Join the requested conversation (or the default one), started between
+	// the requested personas (or the default ones)
+	sess, err := s.sessions.Acquire(r.URL.Query().Get("conversation"), s.spec(r))
+	if err != nil {
+		logger.Printf("Rejecting %s client: %v", s.role.Name, err)
+		http.Error(w, err.Error(), sessionErrorStatus(err))
+		return
+	}
+	defer sess.Release()
+
+	// Upgrade HTTP connection to WebSocket
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Printf("Failed to upgrade connection: %v", err)
+		return
+	}
+
+	// Add the client to the conversation's viewers
+	h := s.hub(sess)
+	sub := h.Subscribe(conn)
+	connections.Inc(string(s.role.Side))
+	logger.Printf("%s client connected to conversation %s between %s", s.role.Name, sess.ID, strings.Join(sess.Personas(), ", "))
+
+	// Handle connection closure
+	defer func() {
+		h.Unsubscribe(sub)
+		connections.Dec(string(s.role.Side))
+		logger.Printf("%s client disconnected", s.role.Name)
+	}()
+
+	// Read messages from client
+	for {
+		var msg types.ConversationMessage
+		err := conn.ReadJSON(&msg)
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				logger.Printf("WebSocket error: %v", err)
+			}
+			break
+		}
+
+		// Handle reset message
+		if msg.Type == types.MessageTypeReset {
+			logger.Printf("%s client requested reset", s.role.Name)
+			sess.Reset()
+			// Send acknowledgment to every viewer, the conversation was reset for
+			// all of them; it carries the new generation
+			h.Broadcast(sess.Turns.Stamp(types.ConversationMessage{Type: types.MessageTypeResetAck}))
+			continue
+		}
+
+		// Handle pause, resume and step
+		if s.control(sess, msg.Type) {
+			// Acknowledge to every viewer, the conversation is held or released for all of them
+			h.Broadcast(sess.Turns.Stamp(types.ConversationMessage{Type: msg.Type}))
+			continue
+		}
+
+		// A message written before the last reset is meant for the old
+		// conversation; tell the sender instead of passing it on
+		if stale(sess, msg) && (msg.Text != "" || types.IsOperatorMessage(msg.Type)) {
+			logger.Printf("%s client sent a message from generation %d, rejecting it", s.role.Name, msg.Generation)
+			h.Send(sub, sess.Turns.Stamp(types.ConversationMessage{
+				Type:   types.MessageTypeError,
+				Text:   "The conversation was reset before your message arrived. Send it again.",
+				Reason: types.ErrorReasonStale,
+			}))
+			continue
+		}
+
+		// Operator messages steer the running conversation
+		if types.IsOperatorMessage(msg.Type) {
+			s.steer(sess, h, sub, msg)
+			continue
+		}
+
+		// Forward text to AI if present
+		if msg.Text != "" {
+			if s.role.Inbound == EchoAndForward {
+				// Send the message back to the clients
+				h.Broadcast(sess.Turns.Stamp(msg))
+			}
+
+			logger.Printf("%s client sent: %s", s.role.Name, msg.Text)
+			if err := sess.ToAI(s.role.Side).Send(sess.Context(), sess.Turns.Stamp(types.ConversationMessage{Text: msg.Text})); err != nil {
+				h.Send(sub, sess.Turns.Stamp(rejected(err)))
+			}
+		}
+	}
+}
+
+// control applies a pause, resume or step message and reports whether it was one
+func (s *Server) control(sess *session.Session, messageType string) bool {
+	switch messageType {
+	case types.MessageTypePause:
+		sess.Pause()
+	case types.MessageTypeResume:
+		sess.Resume()
+	case types.MessageTypeStep:
+		sess.Step()
+	default:
+		return false
+	}
+	logger.Printf("%s client requested %s", s.role.Name, messageType)
+	return true
+}
+
+// steer passes an operator message to the conversation's AIs. Only clients of
+// a steering role may send them; failures are reported to the sender alone.
+func (s *Server) steer(sess *session.Session, h *hub, sub *subscriber, msg types.ConversationMessage) {
+	if !s.role.Steers || msg.Text == "" {
+		logger.Printf("Ignoring %s message from %s client", msg.Type, s.role.Name)
+		return
+	}
+	logger.Printf("%s client sent %s: %s", s.role.Name, msg.Type, msg.Text)
+	if err := sess.Steer(msg); err != nil {
+		h.Send(sub, sess.Turns.Stamp(rejected(err)))
+	}
+}
+
+// stale reports whether a client's message was written before the last reset.
+// Clients label their messages with the latest generation they have seen;
+// unlabeled messages are taken to be current.
+func stale(sess *session.Session, msg types.ConversationMessage) bool {
+	return msg.Generation != 0 && sess.Turns.Stale(msg)
+}
+
+// rejected tells the sender of a message that it did not reach the AI
+func rejected(err error) types.ConversationMessage {
+	if errors.Is(err, delivery.ErrDropped) {
+		return types.ConversationMessage{
+			Type:   types.MessageTypeError,
+			Text:   "The conversation is busy and your message was lost. Send it again.",
+			Reason: types.ErrorReasonDropped,
+		}
+	}
+	return types.ConversationMessage{Type: types.MessageTypeError, Text: err.Error()}
+}
+
+// broadcastFromAI listens for messages from a conversation's AI and sends to
+// all of its clients, dropping those from before the last reset
+func (s *Server) broadcastFromAI(ctx context.Context, sess *session.Session) {
+	defer s.removeHub(sess)
+	h := s.hub(sess)
+
+	fromAI := sess.FromAI(s.role.Side)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-fromAI:
+			if sess.Turns.Stale(msg) {
+				logger.Printf("%s %s: dropping a message from before the last reset", s.role.Name, sess.ID)
+				continue
+			}
+			h.Broadcast(msg)
+		}
+	}
+}
+
+// spec returns the personas a client asks for: ?asker=...&answerer=... for a
+// pair, or ?panel=a,b,c&strategy=... for a round table
+func (s *Server) spec(r *http.Request) session.Spec {
+	query := r.URL.Query()
+	spec := session.Spec{
+		Asker:      query.Get("asker"),
+		Answerer:   query.Get("answerer"),
+		Human:      query.Get("human"),
+		RoundTable: s.role.Side == persona.Moderator,
+		Strategy:   query.Get("strategy"),
+	}
+	if spec.RoundTable {
+		for _, name := range strings.Split(query.Get("panel"), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				spec.Panel = append(spec.Panel, name)
+			}
+		}
+	}
+	return spec
+}
+
+// sessionErrorStatus maps a session.Manager error to an HTTP status code
+func sessionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, session.ErrInvalidID), errors.Is(err, persona.ErrUnknown), errors.Is(err, persona.ErrWrongRole),
+		errors.Is(err, persona.ErrPanel), errors.Is(err, ai.ErrUnknownStrategy), errors.Is(err, session.ErrInvalidHuman):
+		return http.StatusBadRequest
+	case errors.Is(err, session.ErrPersonaMismatch):
+		return http.StatusConflict
+	}
+	return http.StatusServiceUnavailable
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/ai"
+	"github.com/dmh2000/ai-server/internal/llm"
+	"github.com/dmh2000/ai-server/internal/persona"
+	"github.com/dmh2000/ai-server/internal/session"
+)
+
+// newTestServer returns an asker server of conversations between the built-in
+// personas, played by fake backends
+func newTestServer(t *testing.T, idleTimeout time.Duration) (*Server, *session.Manager) {
+	t.Helper()
+	prompts := ai.DefaultPrompts()
+	personas, err := persona.NewRegistry([]*persona.Persona{
+		{Name: "alice", Role: persona.Answerer, Prompt: prompts["alice"]},
+		{Name: "bob", Role: persona.Asker, Prompt: prompts["bob"]},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := session.NewManager(session.Options{
+		ChannelBuffer:   4,
+		IdleTimeout:     idleTimeout,
+		Personas:        personas,
+		DefaultAsker:    "bob",
+		DefaultAnswerer: "alice",
+	}, func(p *persona.Persona) (llm.Backend, error) {
+		return llm.NewFakeBackend(p.Root, nil, 0), nil
+	})
+	return New(AskerRole, sessions, Options{QueueSize: 4}), sessions
+}
+
+// hasHub reports whether the server keeps a hub for the session
+func hasHub(s *Server, sess *session.Session) bool {
+	s.hubMutex.Lock()
+	defer s.hubMutex.Unlock()
+	_, ok := s.hubs[sess]
+	return ok
+}
+
+func TestHubPerSession(t *testing.T) {
+	s, sessions := newTestServer(t, 10*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sessions.Start(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	old, err := sessions.Acquire("c1", session.Spec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldHub := s.hub(old)
+	if s.hub(old) != oldHub {
+		t.Fatal("a session's clients got different hubs")
+	}
+
+	// the idle session is collected, and the conversation started again
+	// while it may still be closing
+	old.Release()
+	select {
+	case <-old.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the idle session was not collected")
+	}
+	sess, err := sessions.Acquire("c1", session.Spec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := s.hub(sess)
+	if h == oldHub {
+		t.Fatal("the new session shares the old session's hub")
+	}
+
+	// the old session's hub is removed once it has closed, the new one's kept
+	for deadline := time.Now().Add(5 * time.Second); hasHub(s, old); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the closed session's hub was not removed")
+		}
+	}
+	if s.hub(sess) != h {
+		t.Error("removing the old session's hub removed the new session's")
+	}
+}
+
+func TestHubOfClosedSession(t *testing.T) {
+	s, sessions := newTestServer(t, time.Minute)
+	sess, err := sessions.Acquire("c1", session.Spec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sessions.Start(ctx) // closes every session
+
+	s.hub(sess)
+	if hasHub(s, sess) {
+		t.Error("the server keeps a hub for a closed session")
+	}
+}
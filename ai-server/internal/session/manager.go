@@ -0,0 +1,282 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/ai"
+	"github.com/dmh2000/ai-server/internal/delivery"
+	"github.com/dmh2000/ai-server/internal/llm"
+	"github.com/dmh2000/ai-server/internal/logger"
+	"github.com/dmh2000/ai-server/internal/persona"
+	"github.com/dmh2000/ai-server/internal/transcript"
+	"github.com/dmh2000/ai-server/internal/window"
+)
+
+// DefaultID is the conversation used by clients that do not ask for one
+const DefaultID = "default"
+
+var (
+	// ErrInvalidID is returned for conversation IDs that are not safe to use
+	ErrInvalidID = errors.New("invalid conversation id")
+	// ErrTooManySessions is returned when the session limit has been reached
+	ErrTooManySessions = errors.New("too many active conversations")
+	// ErrPersonaMismatch is returned when a client asks for personas other
+	// than the ones an existing conversation was started with
+	ErrPersonaMismatch = errors.New("conversation has different personas")
+	// ErrInvalidHuman is returned for a human player of a side that does not exist
+	ErrInvalidHuman = errors.New("a person can only play the asker or the answerer")
+	// ErrNotSteerable is returned for operator messages to a round table,
+	// where the operator steers with plain messages instead
+	ErrNotSteerable = errors.New("round tables are steered with plain messages")
+	// ErrUnknownTarget is returned for an operator note to a persona that is
+	// not in the conversation
+	ErrUnknownTarget = errors.New("no such persona in this conversation")
+)
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// BackendFactory creates the LLM backend for a persona
+type BackendFactory func(p *persona.Persona) (llm.Backend, error)
+
+// Options configures a Manager
+type Options struct {
+	ChannelBuffer int
+	Delivery      delivery.Options  // what a full channel does with a message
+	Limits        ai.Limits         // bounds every conversation
+	IdleTimeout   time.Duration     // close sessions with no clients for this long
+	MaxSessions   int               // 0 for unlimited
+	Transcripts   *transcript.Store // nil disables transcripts
+	Speaker       ai.Speaker        // nil disables speech
+	Prompts       ai.PromptSource   // nil for the personas' own system prompts
+	Window        window.Options    // keeps each persona's context within its token limit
+
+	// Personas of conversations whose clients do not ask for specific ones
+	Personas        *persona.Registry
+	DefaultAsker    string
+	DefaultAnswerer string
+	DefaultStrategy string // turn-taking at round tables, see ai.NewScheduler
+
+	// How long a person playing a persona has to reply before the model
+	// replies for them, 0 to wait indefinitely
+	HumanTimeout time.Duration
+}
+
+// Spec names the personas of a new conversation: an asker and answerer pair,
+// or the panel of a round table. Empty fields select the defaults; a round
+// table has no default panel. Human names the side of a pair played by a
+// person, "asker" or "answerer", or is empty for none.
+type Spec struct {
+	Asker      string
+	Answerer   string
+	Human      string
+	RoundTable bool
+	Panel      []string
+	Strategy   string
+}
+
+// matches reports whether the session is the kind of conversation the spec
+// asks for, between the personas it names
+func (spec Spec) matches(s *Session) bool {
+	if spec.RoundTable {
+		return s.Moderator != nil && (len(spec.Panel) == 0 || slices.Equal(spec.Panel, s.Personas()))
+	}
+	return s.Moderator == nil &&
+		(spec.Asker == "" || spec.Asker == s.Pair.Asker.Name) &&
+		(spec.Answerer == "" || spec.Answerer == s.Pair.Answerer.Name) &&
+		(spec.Human == "" || persona.Role(spec.Human) == s.Human)
+}
+
+// Manager creates a Session per conversation ID and closes idle ones
+type Manager struct {
+	opts       Options
+	newBackend BackendFactory
+
+	mutex    sync.Mutex
+	sessions map[string]*Session
+	closed   bool
+	hooks    []func(ctx context.Context, s *Session)
+}
+
+// NewManager creates a session manager
+func NewManager(opts Options, newBackend BackendFactory) *Manager {
+	return &Manager{
+		opts:       opts,
+		newBackend: newBackend,
+		sessions:   make(map[string]*Session),
+	}
+}
+
+// OnSessionStart registers fn to run in its own goroutine for every new session.
+// fn should return when ctx is done. Hooks must be registered before Acquire is called.
+func (m *Manager) OnSessionStart(fn func(ctx context.Context, s *Session)) {
+	m.hooks = append(m.hooks, fn)
+}
+
+// Acquire returns the session for id, creating and starting it if needed, and
+// attaches a client to it. A new conversation is held between the personas
+// named by spec; naming other personas than an existing conversation's is an
+// error. The caller must call Release on the session when the client disconnects.
+func (m *Manager) Acquire(id string, spec Spec) (*Session, error) {
+	if id == "" {
+		id = DefaultID
+	}
+	if !validID.MatchString(id) {
+		return nil, ErrInvalidID
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if s, ok := m.sessions[id]; ok {
+		if !spec.matches(s) {
+			return nil, ErrPersonaMismatch
+		}
+		s.attach()
+		return s, nil
+	}
+	if m.closed {
+		return nil, context.Canceled
+	}
+	if m.opts.MaxSessions > 0 && len(m.sessions) >= m.opts.MaxSessions {
+		return nil, ErrTooManySessions
+	}
+
+	var s *Session
+	var err error
+	if spec.RoundTable {
+		s, err = m.newRoundTable(id, spec)
+	} else {
+		s, err = m.newPair(id, spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.start()
+	for _, hook := range m.hooks {
+		s.Go(func(ctx context.Context) { hook(ctx, s) })
+	}
+	s.attach()
+	m.sessions[id] = s
+
+	logger.Printf("Session %s started between %s (%d active)", id, strings.Join(s.Personas(), ", "), len(m.sessions))
+	return s, nil
+}
+
+// newPair creates a session between the asker and answerer named by spec
+func (m *Manager) newPair(id string, spec Spec) (*Session, error) {
+	human := persona.Role(spec.Human)
+	if human != "" && human != persona.Asker && human != persona.Answerer {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidHuman, spec.Human)
+	}
+	asker, answerer := spec.Asker, spec.Answerer
+	if asker == "" {
+		asker = m.opts.DefaultAsker
+	}
+	if answerer == "" {
+		answerer = m.opts.DefaultAnswerer
+	}
+	pair, err := m.opts.Personas.Pair(asker, answerer)
+	if err != nil {
+		return nil, err
+	}
+	askerBackend, err := m.newBackend(pair.Asker)
+	if err != nil {
+		return nil, err
+	}
+	answererBackend, err := m.newBackend(pair.Answerer)
+	if err != nil {
+		return nil, err
+	}
+	return newSession(id, m.opts, pair, human, askerBackend, answererBackend)
+}
+
+// newRoundTable creates a round table of the panel named by spec. The llm
+// strategy picks speakers with the first panelist's model.
+func (m *Manager) newRoundTable(id string, spec Spec) (*Session, error) {
+	panel, err := m.opts.Personas.Panel(spec.Panel)
+	if err != nil {
+		return nil, err
+	}
+	backends := map[string]llm.Backend{}
+	for _, p := range panel {
+		if backends[p.Name], err = m.newBackend(p); err != nil {
+			return nil, err
+		}
+	}
+
+	strategy := spec.Strategy
+	if strategy == "" {
+		strategy = m.opts.DefaultStrategy
+	}
+	chooser, err := m.newBackend(panel[0])
+	if err != nil {
+		return nil, err
+	}
+	scheduler, err := ai.NewScheduler(strategy, chooser, panel[0].Settings)
+	if err != nil {
+		return nil, err
+	}
+	return newRoundTable(id, m.opts, panel, scheduler, backends)
+}
+
+// Start periodically closes idle sessions until ctx is done, then closes all sessions
+func (m *Manager) Start(ctx context.Context) {
+	interval := m.opts.IdleTimeout / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.closeAll()
+			return
+		case <-ticker.C:
+			m.collectIdle()
+		}
+	}
+}
+
+// collectIdle closes sessions that have had no clients for the idle timeout
+func (m *Manager) collectIdle() {
+	cutoff := time.Now().Add(-m.opts.IdleTimeout)
+
+	m.mutex.Lock()
+	var idle []*Session
+	for id, s := range m.sessions {
+		if s.idleSince(cutoff) {
+			idle = append(idle, s)
+			delete(m.sessions, id)
+		}
+	}
+	remaining := len(m.sessions)
+	m.mutex.Unlock()
+
+	for _, s := range idle {
+		s.close()
+		logger.Printf("Session %s closed after being idle (%d active)", s.ID, remaining)
+	}
+}
+
+// closeAll closes every session and refuses new ones
+func (m *Manager) closeAll() {
+	m.mutex.Lock()
+	m.closed = true
+	sessions := m.sessions
+	m.sessions = make(map[string]*Session)
+	m.mutex.Unlock()
+
+	for _, s := range sessions {
+		s.close()
+	}
+	logger.Println("All sessions closed")
+}
@@ -0,0 +1,135 @@
+package session
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/ai"
+	"github.com/dmh2000/ai-server/internal/llm"
+	"github.com/dmh2000/ai-server/internal/persona"
+)
+
+// newTestManager returns a manager of conversations between the built-in
+// personas, played by fake backends
+func newTestManager(t *testing.T, idleTimeout time.Duration) *Manager {
+	t.Helper()
+	prompts := ai.DefaultPrompts()
+	personas, err := persona.NewRegistry([]*persona.Persona{
+		{Name: "alice", Role: persona.Answerer, Prompt: prompts["alice"]},
+		{Name: "bob", Role: persona.Asker, Prompt: prompts["bob"]},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{
+		ChannelBuffer:   4,
+		IdleTimeout:     idleTimeout,
+		Personas:        personas,
+		DefaultAsker:    "bob",
+		DefaultAnswerer: "alice",
+	}
+	m := NewManager(opts, func(p *persona.Persona) (llm.Backend, error) {
+		return llm.NewFakeBackend(p.Root, nil, 0), nil
+	})
+	t.Cleanup(m.closeAll)
+	return m
+}
+
+// active returns the IDs of the manager's sessions
+func active(m *Manager) map[string]bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	ids := map[string]bool{}
+	for id := range m.sessions {
+		ids[id] = true
+	}
+	return ids
+}
+
+// closed reports whether a session has been closed
+func closed(s *Session) bool {
+	return s.Context().Err() != nil
+}
+
+func TestCollectIdle(t *testing.T) {
+	const idleTimeout = 20 * time.Millisecond
+	m := newTestManager(t, idleTimeout)
+
+	acquire := func(id string) *Session {
+		t.Helper()
+		s, err := m.Acquire(id, Spec{})
+		if err != nil {
+			t.Fatalf("Acquire(%s): %v", id, err)
+		}
+		return s
+	}
+	connected := acquire("connected")
+	released := acquire("released")
+	released.Release()
+	touched := acquire("touched")
+	touched.Release()
+
+	time.Sleep(2 * idleTimeout)
+	touched.Touch()
+	m.collectIdle()
+
+	want := map[string]bool{"connected": true, "touched": true}
+	if got := active(m); !reflect.DeepEqual(got, want) {
+		t.Errorf("active sessions %v, want %v", got, want)
+	}
+	if !closed(released) {
+		t.Error("the idle session was not closed")
+	}
+	if closed(connected) || closed(touched) {
+		t.Error("a session in use was closed")
+	}
+
+	// a session whose last client left long enough ago is collected next time
+	connected.Release()
+	time.Sleep(2 * idleTimeout)
+	m.collectIdle()
+	if got := active(m); len(got) != 0 {
+		t.Errorf("active sessions %v, want none", got)
+	}
+	if !closed(connected) || !closed(touched) {
+		t.Error("the idle sessions were not closed")
+	}
+}
+
+func TestAcquireAfterCollection(t *testing.T) {
+	const idleTimeout = 20 * time.Millisecond
+	m := newTestManager(t, idleTimeout)
+
+	old, err := m.Acquire("c1", Spec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.Release()
+	time.Sleep(2 * idleTimeout)
+	m.collectIdle()
+
+	s, err := m.Acquire("c1", Spec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s == old || closed(s) {
+		t.Error("acquiring a collected conversation did not start a new session")
+	}
+}
+
+func TestCloseAll(t *testing.T) {
+	m := newTestManager(t, time.Minute)
+	s, err := m.Acquire("c1", Spec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.closeAll()
+	if !closed(s) {
+		t.Error("closeAll did not close the session")
+	}
+	if _, err := m.Acquire("c2", Spec{}); err == nil {
+		t.Error("Acquire after closeAll started a session")
+	}
+}
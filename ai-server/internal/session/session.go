@@ -0,0 +1,526 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/ai"
+	"github.com/dmh2000/ai-server/internal/delivery"
+	"github.com/dmh2000/ai-server/internal/llm"
+	"github.com/dmh2000/ai-server/internal/logger"
+	"github.com/dmh2000/ai-server/internal/metrics"
+	"github.com/dmh2000/ai-server/internal/persona"
+	"github.com/dmh2000/ai-server/internal/transcript"
+	"github.com/dmh2000/ai-server/internal/types"
+	"github.com/dmh2000/ai-server/internal/window"
+)
+
+// resets counts the conversation resets, served at /metrics
+var resets = metrics.NewCounter("conversation_resets_total", "Conversations reset by a client")
+
+// Session is one isolated conversation: its own asker/answerer pair or round
+// table, with independent context, pause state and channels
+type Session struct {
+	ID    string
+	Pair  persona.Pair       // zero at a round table
+	Panel []*persona.Persona // nil for a pair
+	Human persona.Role       // side of a pair played by a person, "" if none
+
+	Asker     *ai.Asker
+	Answerer  *ai.Answerer
+	Moderator *ai.Moderator // nil for a pair
+	Budget    *ai.Budget
+	Gate      *ai.Gate
+	Turns     *ai.Turns
+
+	// Server side of the channels; those of the other kind of conversation are nil
+	AskerToAI       *delivery.Channel
+	AskerFromAI     <-chan types.ConversationMessage
+	AnswererToAI    *delivery.Channel
+	AnswererFromAI  <-chan types.ConversationMessage
+	ModeratorToAI   *delivery.Channel
+	ModeratorFromAI <-chan types.ConversationMessage
+
+	members []member // the AI components of either kind of conversation
+
+	transcripts     *transcript.Store
+	transcript      *transcript.Transcript // current conversation, nil if not recording
+	transcriptMutex sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	activityMutex sync.Mutex
+	clients       int
+	lastActive    time.Time
+}
+
+// member is an AI component of a session
+type member interface {
+	Start(ctx context.Context)
+	Reset()
+	End(reason string, text string)
+	ReportError(text string, class string)
+	SetConversation(conversation ai.Conversation)
+}
+
+// newBaseSession creates a session without AI components
+func newBaseSession(id string, opts Options) *Session {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Session{
+		ID:          id,
+		Budget:      ai.NewBudget(opts.Limits),
+		Gate:        ai.NewGate(),
+		Turns:       ai.NewTurns(ctx, id),
+		transcripts: opts.Transcripts,
+		ctx:         ctx,
+		cancel:      cancel,
+		lastActive:  time.Now(),
+	}
+}
+
+// newSession creates the channels and AI pair for a conversation, with one
+// side played by a person if human is set
+func newSession(id string, opts Options, pair persona.Pair, human persona.Role, askerBackend, answererBackend llm.Backend) (*Session, error) {
+	// each persona trims its own context, and writes its own summaries
+	askerTrimmer, err := window.New(opts.Window, askerBackend, pair.Asker.Settings)
+	if err != nil {
+		return nil, err
+	}
+	answererTrimmer, err := window.New(opts.Window, answererBackend, pair.Answerer.Settings)
+	if err != nil {
+		return nil, err
+	}
+
+	channelBuffer := opts.ChannelBuffer
+
+	// asker server <-> asker AI
+	askerServerToAI := delivery.New(delivery.ServerToAI, channelBuffer, opts.Delivery)
+	askerAIToServer := delivery.New(delivery.AIToServer, channelBuffer, opts.Delivery)
+
+	// answerer server <-> answerer AI
+	answererServerToAI := delivery.New(delivery.ServerToAI, channelBuffer, opts.Delivery)
+	answererAIToServer := delivery.New(delivery.AIToServer, channelBuffer, opts.Delivery)
+
+	// asker AI -> answerer AI
+	askerToAnswerer := delivery.New(delivery.AskerToAnswerer, channelBuffer, opts.Delivery)
+
+	// answerer AI -> asker AI (for context)
+	answererToAsker := delivery.New(delivery.AnswererToAsker, channelBuffer, opts.Delivery)
+
+	s := newBaseSession(id, opts)
+	s.Pair = pair
+	s.Asker = ai.NewAsker(pair.Asker, askerServerToAI.Receive(), askerAIToServer, askerToAnswerer, answererToAsker.Receive(), askerBackend)
+	s.Answerer = ai.NewAnswerer(pair.Answerer, answererServerToAI.Receive(), answererAIToServer, askerToAnswerer.Receive(), answererToAsker, answererBackend)
+	s.AskerToAI = askerServerToAI
+	s.AskerFromAI = askerAIToServer.Receive()
+	s.AnswererToAI = answererServerToAI
+	s.AnswererFromAI = answererAIToServer.Receive()
+	s.Asker.SetTrimmer(askerTrimmer)
+	s.Answerer.SetTrimmer(answererTrimmer)
+
+	// A turn dropped between the AIs stalls the conversation, so every client
+	// is told; a message dropped on its way to the clients only its own side
+	askerToAnswerer.OnDrop(func(types.ConversationMessage) {
+		s.lose(pair.Asker.DisplayName + "'s question to " + pair.Answerer.DisplayName)
+	})
+	answererToAsker.OnDrop(func(types.ConversationMessage) {
+		s.lose(pair.Answerer.DisplayName + "'s answer to " + pair.Asker.DisplayName)
+	})
+	askerAIToServer.OnDrop(s.hide(s.Asker, pair.Asker.DisplayName))
+	answererAIToServer.OnDrop(s.hide(s.Answerer, pair.Answerer.DisplayName))
+
+	// A person playing a side replies from its web client, with the model as fallback
+	s.Human = human
+	switch human {
+	case persona.Asker:
+		s.Asker.SetHuman(opts.HumanTimeout)
+	case persona.Answerer:
+		s.Answerer.SetHuman(opts.HumanTimeout)
+	}
+
+	// When the asker starts a new conversation, resume the answerer, restart
+	// the budget and start a new transcript
+	s.Asker.SetStartNewConvCallback(func() {
+		s.Budget.Restart()
+		s.startTranscript()
+		s.Answerer.Resume()
+		logger.Printf("Session %s: %s AI resumed for new conversation", s.ID, pair.Answerer.DisplayName)
+	})
+
+	s.addMembers(opts, s.Answerer, s.Asker)
+	return s, nil
+}
+
+// newRoundTable creates the channels and moderator for a round-table
+// conversation. The shared transcript is summarized with the first panelist's model.
+func newRoundTable(id string, opts Options, panel []*persona.Persona, scheduler ai.Scheduler, backends map[string]llm.Backend) (*Session, error) {
+	trimmer, err := window.New(opts.Window, backends[panel[0].Name], panel[0].Settings)
+	if err != nil {
+		return nil, err
+	}
+
+	// moderator server <-> moderator
+	serverToAI := delivery.New(delivery.ServerToAI, opts.ChannelBuffer, opts.Delivery)
+	aiToServer := delivery.New(delivery.AIToServer, opts.ChannelBuffer, opts.Delivery)
+
+	s := newBaseSession(id, opts)
+	s.Panel = panel
+	s.Moderator = ai.NewModerator(panel, scheduler, serverToAI.Receive(), aiToServer, backends)
+	s.ModeratorToAI = serverToAI
+	s.ModeratorFromAI = aiToServer.Receive()
+	s.Moderator.SetTrimmer(trimmer)
+	aiToServer.OnDrop(s.hide(s.Moderator, "The round table"))
+
+	// When the operator starts a new discussion, restart the budget and start
+	// a new transcript
+	s.Moderator.SetStartNewConvCallback(func() {
+		s.Budget.Restart()
+		s.startTranscript()
+	})
+
+	s.addMembers(opts, s.Moderator)
+	return s, nil
+}
+
+// addMembers wires the AI components to the session
+func (s *Session) addMembers(opts Options, members ...member) {
+	conversation := ai.Conversation{
+		// All members share the budget; whichever runs out first ends it for all
+		Budget: s.Budget,
+		OnEnd:  s.end,
+
+		// All members wait at the same gate, so a step allows one turn in all
+		Gate: s.Gate,
+
+		// Resetting or ending the conversation cancels the turns of all members,
+		// and a reset starts a new generation of their messages
+		Turns: s.Turns,
+
+		// A failed turn is reported to every client
+		OnError: s.fail,
+
+		// Record every turn in the transcript
+		Recorder: s,
+
+		// Read the system prompts from the prompt source, if any, and voice
+		// every turn with the speaker, if any
+		Prompts: opts.Prompts,
+		Speaker: opts.Speaker,
+
+		// Count the tokens of the queries as the context window does
+		Counter: opts.Window.Counter,
+	}
+	for _, m := range members {
+		m.SetConversation(conversation)
+	}
+	s.members = append(s.members, members...)
+}
+
+// ToAI returns the channel that carries a side's client messages to its AI
+func (s *Session) ToAI(side persona.Role) *delivery.Channel {
+	switch side {
+	case persona.Answerer:
+		return s.AnswererToAI
+	case persona.Moderator:
+		return s.ModeratorToAI
+	}
+	return s.AskerToAI
+}
+
+// FromAI returns the channel that carries a side's AI messages to its clients
+func (s *Session) FromAI(side persona.Role) <-chan types.ConversationMessage {
+	switch side {
+	case persona.Answerer:
+		return s.AnswererFromAI
+	case persona.Moderator:
+		return s.ModeratorFromAI
+	}
+	return s.AskerFromAI
+}
+
+// Steer passes an operator message to the AI of a pair it is meant for:
+// notes go to their target, overrides and topic changes to the asker. It
+// returns an error if the message was dropped.
+func (s *Session) Steer(msg types.ConversationMessage) error {
+	if s.Moderator != nil {
+		return ErrNotSteerable
+	}
+
+	side := persona.Asker
+	if msg.Type == types.MessageTypeInject {
+		switch msg.Target {
+		case "", string(persona.Asker):
+		case string(persona.Answerer):
+			side = persona.Answerer
+		default:
+			p := s.persona(msg.Target)
+			if p == nil {
+				return fmt.Errorf("%w: %s", ErrUnknownTarget, msg.Target)
+			}
+			side = p.Role
+		}
+	}
+
+	return s.ToAI(side).Send(s.ctx, s.Turns.Stamp(msg))
+}
+
+// persona returns the persona with the given name in this conversation, or nil
+func (s *Session) persona(name string) *persona.Persona {
+	for _, p := range s.Panel {
+		if p.Name == name {
+			return p
+		}
+	}
+	if s.Moderator != nil {
+		return nil
+	}
+	return s.Pair.Get(name)
+}
+
+// Personas returns the names of the personas in the conversation
+func (s *Session) Personas() []string {
+	if s.Moderator == nil {
+		return []string{s.Pair.Asker.Name, s.Pair.Answerer.Name}
+	}
+	names := make([]string, 0, len(s.Panel))
+	for _, p := range s.Panel {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// Context returns the session context, which is cancelled when the session closes
+func (s *Session) Context() context.Context {
+	return s.ctx
+}
+
+// Go runs fn in a goroutine that the session waits for on close
+func (s *Session) Go(fn func(ctx context.Context)) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		fn(s.ctx)
+	}()
+}
+
+// start launches the AI components
+func (s *Session) start() {
+	for _, m := range s.members {
+		s.Go(m.Start)
+	}
+}
+
+// close stops the AI components and any session goroutines and waits for them
+func (s *Session) close() {
+	s.cancel()
+	s.wg.Wait()
+	s.closeTranscript()
+}
+
+// startTranscript closes the current transcript and opens a new one
+func (s *Session) startTranscript() {
+	s.closeTranscript()
+	if s.transcripts == nil {
+		return
+	}
+
+	t, err := s.transcripts.Create(s.ID)
+	if err != nil {
+		logger.Printf("Session %s: failed to create transcript: %v", s.ID, err)
+		return
+	}
+	s.transcriptMutex.Lock()
+	s.transcript = t
+	s.transcriptMutex.Unlock()
+	logger.Printf("Session %s: recording transcript %s", s.ID, t.ID)
+}
+
+// closeTranscript closes the current transcript, if any
+func (s *Session) closeTranscript() {
+	s.transcriptMutex.Lock()
+	t := s.transcript
+	s.transcript = nil
+	s.transcriptMutex.Unlock()
+
+	if t != nil {
+		if err := t.Close(); err != nil {
+			logger.Printf("Session %s: failed to close transcript: %v", s.ID, err)
+		}
+	}
+}
+
+// Record writes a turn to the current transcript (implements ai.Recorder)
+func (s *Session) Record(speaker string, raw string, text string) {
+	s.transcriptMutex.Lock()
+	t := s.transcript
+	s.transcriptMutex.Unlock()
+	if t == nil {
+		return
+	}
+
+	var role string
+	switch p := s.persona(speaker); {
+	case s.Moderator != nil && speaker == persona.ModeratorName:
+		role = string(persona.Moderator)
+	case s.Moderator != nil && p != nil:
+		role = string(persona.Panelist)
+	case p != nil:
+		role = string(p.Role)
+	}
+	turn := transcript.Turn{
+		Speaker:   speaker,
+		Role:      role,
+		Timestamp: time.Now(),
+		Raw:       raw,
+		Text:      text,
+	}
+	if err := t.Record(turn); err != nil {
+		logger.Printf("Session %s: failed to record turn: %v", s.ID, err)
+	}
+}
+
+// end stops the AIs and notifies every client
+func (s *Session) end(reason string) {
+	if !s.Budget.End() {
+		return
+	}
+	text := s.Budget.EndText(reason)
+	for _, m := range s.members {
+		m.End(reason, text)
+	}
+	s.Turns.Cancel()
+	s.closeTranscript()
+	logger.Printf("Session %s: conversation ended (%s)", s.ID, reason)
+}
+
+// fail tells every client that a persona's turn failed, so the operator can
+// continue the conversation with a new question
+func (s *Session) fail(name string, err error) {
+	class := llm.Classify(err)
+	displayName := "The " + name
+	if p := s.persona(name); p != nil {
+		displayName = p.DisplayName
+	}
+	text := errorText(displayName, class)
+	for _, m := range s.members {
+		m.ReportError(text, string(class))
+	}
+	logger.Printf("Session %s: %s turn failed (%s): %v", s.ID, name, class, err)
+}
+
+// lose tells every client that a turn was dropped by a full channel, so the
+// operator can continue the conversation with a new question
+func (s *Session) lose(what string) {
+	text := what + " was lost. Send a question to continue."
+	for _, m := range s.members {
+		m.ReportError(text, types.ErrorReasonDropped)
+	}
+	logger.Printf("Session %s: %s was lost", s.ID, what)
+}
+
+// hide returns the drop callback of the channel carrying the messages of the
+// named side to its clients, which tells them a message could not be shown.
+// Dropped deltas are made up for by their final message, and dropped errors
+// are not reported again.
+func (s *Session) hide(m member, name string) func(msg types.ConversationMessage) {
+	return func(msg types.ConversationMessage) {
+		switch msg.Type {
+		case types.MessageTypeDelta, types.MessageTypeError:
+			return
+		}
+		m.ReportError(name+"'s last message could not be shown.", types.ErrorReasonDropped)
+	}
+}
+
+// errorText describes a failed turn of the named persona for the clients
+func errorText(name string, class llm.ErrorClass) string {
+	var cause string
+	switch class {
+	case llm.ErrorRateLimit:
+		cause = "the model is rate limited"
+	case llm.ErrorTimeout:
+		cause = "the model timed out"
+	case llm.ErrorAuth:
+		cause = "the model credentials were rejected"
+	case llm.ErrorContentFilter:
+		cause = "the model's content filter blocked the reply"
+	case llm.ErrorUnavailable:
+		cause = "the model is unavailable"
+	default:
+		cause = "the model query failed"
+	}
+	return fmt.Sprintf("%s could not reply: %s. Send a question to continue.", name, cause)
+}
+
+// Pause holds the conversation before its next turn
+func (s *Session) Pause() {
+	s.Gate.Pause()
+	s.Touch()
+	logger.Printf("Session %s: paused", s.ID)
+}
+
+// Resume lets a paused conversation run freely again
+func (s *Session) Resume() {
+	s.Gate.Resume()
+	s.Touch()
+	logger.Printf("Session %s: resumed", s.ID)
+}
+
+// Step lets the conversation take exactly one more turn and then holds it
+func (s *Session) Step() {
+	s.Gate.Step()
+	s.Touch()
+	logger.Printf("Session %s: stepping one turn", s.ID)
+}
+
+// Reset clears and pauses the AIs and starts a new generation of the
+// conversation. The model queries in flight are cancelled and a held
+// conversation is released, so the turns in progress or waiting at the gate
+// see the reset and are dropped, as are the messages of the old generation.
+func (s *Session) Reset() {
+	// cancel the running turns first, so none of them writes to a context
+	// after it has been cleared
+	generation := s.Turns.Advance()
+	for _, m := range s.members {
+		m.Reset()
+	}
+	resets.Inc()
+	s.Gate.Resume()
+	s.closeTranscript()
+	s.Touch()
+	logger.Printf("Session %s: all AI contexts have been reset, starting generation %d", s.ID, generation)
+}
+
+// attach records a connected client
+func (s *Session) attach() {
+	s.activityMutex.Lock()
+	s.clients++
+	s.lastActive = time.Now()
+	s.activityMutex.Unlock()
+}
+
+// Release records that a client acquired from the Manager has disconnected
+func (s *Session) Release() {
+	s.activityMutex.Lock()
+	s.clients--
+	s.lastActive = time.Now()
+	s.activityMutex.Unlock()
+}
+
+// Touch records client activity
+func (s *Session) Touch() {
+	s.activityMutex.Lock()
+	s.lastActive = time.Now()
+	s.activityMutex.Unlock()
+}
+
+// idleSince reports whether the session has had no clients since before t
+func (s *Session) idleSince(t time.Time) bool {
+	s.activityMutex.Lock()
+	defer s.activityMutex.Unlock()
+	return s.clients <= 0 && s.lastActive.Before(t)
+}
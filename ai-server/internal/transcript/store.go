@@ -0,0 +1,175 @@
+package transcript
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fileExt is the extension of transcript files
+const fileExt = ".jsonl"
+
+// ErrNotFound is returned when a transcript does not exist
+var ErrNotFound = errors.New("transcript not found")
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// Turn is one message of a conversation
+type Turn struct {
+	Speaker   string    `json:"speaker"`
+	Role      string    `json:"role,omitempty"` // "asker", "answerer", "panelist" or "moderator"
+	Timestamp time.Time `json:"timestamp"`
+	Raw       string    `json:"raw"`  // XML exchanged between the personas
+	Text      string    `json:"text"` // cleaned text shown in the UI
+}
+
+// Summary describes a stored transcript
+type Summary struct {
+	ID      string    `json:"id"`
+	Session string    `json:"session"`
+	Started time.Time `json:"started"`
+	Turns   int       `json:"turns"`
+	Topic   string    `json:"topic,omitempty"` // text of the first turn
+}
+
+// Store keeps one JSONL transcript file per conversation in a directory
+type Store struct {
+	dir string
+}
+
+// NewStore creates a store in dir, creating the directory if needed
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Create starts a new transcript for a conversation in the given session
+func (s *Store) Create(session string) (*Transcript, error) {
+	started := time.Now()
+	id := fmt.Sprintf("%s-%s", session, started.Format("20060102-150405.000"))
+	id = strings.ReplaceAll(id, ".", "-")
+
+	f, err := os.OpenFile(s.path(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &Transcript{ID: id, file: f}, nil
+}
+
+// List returns a summary of every stored transcript, newest first
+func (s *Store) List() ([]Summary, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := []Summary{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, fileExt) {
+			continue
+		}
+		id := strings.TrimSuffix(name, fileExt)
+		turns, err := s.Load(id)
+		if err != nil {
+			continue
+		}
+
+		summary := Summary{ID: id, Turns: len(turns)}
+		// the ID is <session>-<yyyymmdd>-<hhmmss>-<ms>
+		if parts := strings.Split(id, "-"); len(parts) > 3 {
+			summary.Session = strings.Join(parts[:len(parts)-3], "-")
+		}
+		if len(turns) > 0 {
+			summary.Started = turns[0].Timestamp
+			summary.Topic = turns[0].Text
+		} else if info, err := entry.Info(); err == nil {
+			summary.Started = info.ModTime()
+		}
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Started.After(summaries[j].Started)
+	})
+	return summaries, nil
+}
+
+// Load returns all turns of a transcript
+func (s *Store) Load(id string) ([]Turn, error) {
+	if !validID.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	f, err := os.Open(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	turns := []Turn{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var turn Turn
+		if err := json.Unmarshal(scanner.Bytes(), &turn); err != nil {
+			// skip a partially written last line
+			continue
+		}
+		turns = append(turns, turn)
+	}
+	return turns, scanner.Err()
+}
+
+// path returns the file name of a transcript
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+fileExt)
+}
+
+// Transcript is an open transcript that turns are appended to
+type Transcript struct {
+	ID    string
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// Record appends a turn to the transcript
+func (t *Transcript) Record(turn Turn) error {
+	line, err := json.Marshal(turn)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.file == nil {
+		return os.ErrClosed
+	}
+	_, err = t.file.Write(line)
+	return err
+}
+
+// Close closes the transcript file
+func (t *Transcript) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	return err
+}
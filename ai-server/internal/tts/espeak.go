@@ -0,0 +1,33 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// EspeakSynthesizer runs a local espeak-ng (or espeak) binary, which speaks
+// offline. The voice is an espeak voice name such as "en+f3".
+type EspeakSynthesizer struct {
+	Path string // binary to run, e.g. "espeak-ng"
+}
+
+// Synthesize speaks text with espeak and returns the WAV it writes to stdout
+func (e EspeakSynthesizer) Synthesize(ctx context.Context, voice string, text string) ([]byte, error) {
+	args := []string{"--stdout"}
+	if voice != "" {
+		args = append(args, "-v", voice)
+	}
+	// "--" ends the options so text starting with '-' is spoken, not parsed
+	args = append(args, "--", text)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.Path, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w: %s", e.Path, err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,80 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	sampleRate   = 16000
+	charDuration = 0.06 // seconds of tone per character of a word
+	maxWordTime  = 0.5  // longest tone for a single word
+	gapDuration  = 0.05 // silence between words
+	amplitude    = 0.3
+)
+
+// ToneSynthesizer is an offline stand-in for a real TTS engine. It renders
+// each word as a short sine tone whose pitch depends on the word, so turns
+// get audio of a plausible length without any external service. The voice is
+// the base frequency in Hz (e.g. "220"); it defaults to 330.
+type ToneSynthesizer struct{}
+
+// Synthesize renders text as a mono 16-bit WAV of word tones
+func (ToneSynthesizer) Synthesize(ctx context.Context, voice string, text string) ([]byte, error) {
+	base, err := strconv.ParseFloat(voice, 64)
+	if err != nil || base <= 0 {
+		base = 330
+	}
+
+	var samples []int16
+	for _, word := range strings.Fields(text) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// vary the pitch by up to an octave, deterministically per word
+		h := fnv.New32a()
+		h.Write([]byte(strings.ToLower(word)))
+		freq := base * (1 + float64(h.Sum32()%100)/100)
+
+		duration := math.Min(float64(len(word))*charDuration, maxWordTime)
+		n := int(duration * sampleRate)
+		for i := 0; i < n; i++ {
+			// fade in and out over 10ms to avoid clicks
+			env := math.Min(1, math.Min(float64(i), float64(n-i))/(0.01*sampleRate))
+			v := amplitude * env * math.Sin(2*math.Pi*freq*float64(i)/sampleRate)
+			samples = append(samples, int16(v*math.MaxInt16))
+		}
+		samples = append(samples, make([]int16, int(gapDuration*sampleRate))...)
+	}
+
+	return encodeWAV(samples), nil
+}
+
+// encodeWAV encodes mono 16-bit PCM samples as a WAV file
+func encodeWAV(samples []int16) []byte {
+	dataSize := len(samples) * 2
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVE")
+
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))           // chunk size
+	binary.Write(&buf, binary.LittleEndian, uint16(1))            // PCM
+	binary.Write(&buf, binary.LittleEndian, uint16(1))            // mono
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))   // sample rate
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*2)) // byte rate
+	binary.Write(&buf, binary.LittleEndian, uint16(2))            // block align
+	binary.Write(&buf, binary.LittleEndian, uint16(16))           // bits per sample
+
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(dataSize))
+	binary.Write(&buf, binary.LittleEndian, samples)
+	return buf.Bytes()
+}
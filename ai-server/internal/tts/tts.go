@@ -0,0 +1,104 @@
+package tts
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/logger"
+)
+
+// Synthesizer converts text to speech, returning a WAV file
+type Synthesizer interface {
+	Synthesize(ctx context.Context, voice string, text string) ([]byte, error)
+}
+
+// Pipeline synthesizes speech for a persona's turn, stores the audio under a
+// directory and returns the URL it is served from
+type Pipeline struct {
+	synth     Synthesizer
+	dir       string
+	urlPrefix string
+	voices    map[string]string // persona -> synthesizer voice
+	count     atomic.Int64
+}
+
+// NewPipeline creates a pipeline writing to dir, whose files are served under
+// urlPrefix (e.g. "/audio/"). voices maps persona names to synthesizer voices.
+func NewPipeline(synth Synthesizer, dir string, urlPrefix string, voices map[string]string) (*Pipeline, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Pipeline{
+		synth:     synth,
+		dir:       dir,
+		urlPrefix: urlPrefix,
+		voices:    voices,
+	}, nil
+}
+
+// Speak synthesizes text in the persona's voice and returns the audio URL
+func (p *Pipeline) Speak(ctx context.Context, persona string, text string) (string, error) {
+	audio, err := p.synth.Synthesize(ctx, p.voices[persona], text)
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("%s-%d-%d.wav", persona, time.Now().UnixNano(), p.count.Add(1))
+	if err := os.WriteFile(filepath.Join(p.dir, name), audio, 0o644); err != nil {
+		return "", err
+	}
+	return p.urlPrefix + name, nil
+}
+
+// Prune deletes the audio files older than maxAge, once now and then
+// periodically until ctx is done, so the directory does not grow without bound.
+// Clients play each file as it arrives, so old files are no longer needed.
+func (p *Pipeline) Prune(ctx context.Context, maxAge time.Duration) {
+	interval := maxAge / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.prune(time.Now().Add(-maxAge))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// prune deletes the audio files last written before cutoff
+func (p *Pipeline) prune(cutoff time.Time) {
+	entries, err := os.ReadDir(p.dir)
+	if err != nil {
+		logger.Printf("Failed to list audio files: %v", err)
+		return
+	}
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".wav") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(p.dir, entry.Name())); err != nil && !os.IsNotExist(err) {
+			logger.Printf("Failed to delete audio file: %v", err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		logger.Printf("Deleted %d audio files older than %s", removed, cutoff.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,76 @@
+package tts
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// files returns the names of the files in dir
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestSpeak(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewPipeline(ToneSynthesizer{}, dir, "/audio/", map[string]string{"alice": "330"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url, err := p.Speak(context.Background(), "alice", "Hello there")
+	if err != nil {
+		t.Fatalf("Speak: %v", err)
+	}
+	name, ok := strings.CutPrefix(url, "/audio/")
+	if !ok || !strings.HasPrefix(name, "alice-") || !strings.HasSuffix(name, ".wav") {
+		t.Errorf("URL = %q, want /audio/alice-....wav", url)
+	}
+	if got := files(t, dir); !reflect.DeepEqual(got, []string{name}) {
+		t.Errorf("files %q, want [%s]", got, name)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewPipeline(ToneSynthesizer{}, dir, "/audio/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for name, age := range map[string]time.Duration{
+		"old.wav":   2 * time.Hour,
+		"new.wav":   time.Minute,
+		"notes.txt": 2 * time.Hour, // not audio
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.Prune(ctx, time.Hour) // prunes once and returns
+	if got, want := files(t, dir), []string{"new.wav", "notes.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("files %q after pruning, want %q", got, want)
+	}
+}
@@ -2,12 +2,75 @@ package types
 
 // ConversationMessage represents a message exchanged via WebSocket
 type ConversationMessage struct {
-	Type string `json:"type,omitempty"`
-	Text string `json:"text,omitempty"`
+	Type   string `json:"type,omitempty"`
+	Text   string `json:"text,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	ID     string `json:"id,omitempty"`    // identifies a streamed message across its deltas and final
+	Seq    int    `json:"seq,omitempty"`   // order of the deltas of a streamed message
+	Audio  string `json:"audio,omitempty"` // URL of the spoken text of a final message
+	// Speaker is the persona that wrote the message at a round table, or
+	// "moderator" for the operator
+	Speaker string `json:"speaker,omitempty"`
+	// Target is the persona an inject message is meant for, by name or role
+	// ("asker" or "answerer"); the asker by default
+	Target string `json:"target,omitempty"`
+	// Conversation and Generation identify the conversation a message belongs
+	// to. The generation advances on every reset, and messages of an earlier
+	// generation are dropped.
+	Conversation string `json:"conversation,omitempty"`
+	Generation   uint64 `json:"generation,omitempty"`
 }
 
 // Message types
 const (
-	MessageTypeReset    = "reset"
-	MessageTypeResetAck = "reset_ack"
+	MessageTypeReset           = "reset"
+	MessageTypeResetAck        = "reset_ack"
+	MessageTypeConversationEnd = "conversation_end"
+
+	// Presenter controls hold the conversation between turns; the server
+	// echoes each to the sender's viewers as acknowledgment
+	MessageTypePause  = "pause"  // hold before the next turn
+	MessageTypeResume = "resume" // run freely again
+	MessageTypeStep   = "step"   // take exactly one more turn, then hold
+
+	// Operator messages steer a running conversation without resetting it
+	MessageTypeInject   = "inject"   // adds the Text as a note to the Target's next prompt
+	MessageTypeOverride = "override" // replaces the asker's next question with the Text
+	MessageTypeTopic    = "topic"    // has the asker change to the topic in the Text
+
+	// An error message tells the UIs a turn failed; its Reason is the error class
+	MessageTypeError = "error"
+
+	// A human_turn message asks the person playing a persona to reply to its Text
+	MessageTypeHumanTurn = "human_turn"
+
+	// A streamed response is sent as delta messages, each with the next piece
+	// of text, followed by a final message with the complete text
+	MessageTypeDelta = "delta"
+	MessageTypeFinal = "final"
+)
+
+// IsOperatorMessage reports whether a message type steers a running conversation
+func IsOperatorMessage(messageType string) bool {
+	switch messageType {
+	case MessageTypeInject, MessageTypeOverride, MessageTypeTopic:
+		return true
+	}
+	return false
+}
+
+// Reasons a conversation ends (Reason of a conversation_end message)
+const (
+	EndReasonMaxTurns    = "max_turns"
+	EndReasonMaxDuration = "max_duration"
+	EndReasonMaxTokens   = "max_tokens"
+
+	EndReasonReplayComplete = "replay_complete"
+)
+
+// Reasons of the error messages about a lost message; other error messages
+// carry the class of the failed query
+const (
+	ErrorReasonDropped = "dropped" // a full channel dropped it
+	ErrorReasonStale   = "stale"   // a client sent it before the last reset
 )
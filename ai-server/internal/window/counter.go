@@ -0,0 +1,50 @@
+package window
+
+import (
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// Counter counts the tokens of a text
+type Counter interface {
+	Count(text string) int
+}
+
+// Estimate approximates token counts at about 4 characters per token, for use
+// when no tokenizer is available
+type Estimate struct{}
+
+// Count returns the estimated token count of text
+func (Estimate) Count(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// Tiktoken counts tokens with a tiktoken encoding. Gemini uses its own
+// tokenizer, so the counts are close rather than exact.
+type Tiktoken struct {
+	encoding *tiktoken.Tiktoken
+}
+
+// NewTiktoken loads a tiktoken encoding, e.g. "cl100k_base". The encoding is
+// downloaded on first use and cached in TIKTOKEN_CACHE_DIR, so this fails
+// offline unless the cache has been filled.
+func NewTiktoken(encoding string) (*Tiktoken, error) {
+	enc, err := tiktoken.GetEncoding(encoding)
+	if err != nil {
+		return nil, err
+	}
+	return &Tiktoken{encoding: enc}, nil
+}
+
+// Count returns the token count of text
+func (t *Tiktoken) Count(text string) int {
+	return len(t.encoding.EncodeOrdinary(text))
+}
+
+// total returns the token count of all texts
+func total(counter Counter, texts ...string) int {
+	n := 0
+	for _, text := range texts {
+		n += counter.Count(text)
+	}
+	return n
+}
@@ -0,0 +1,217 @@
+package window
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmh2000/ai-server/internal/llm"
+	"github.com/dmh2000/ai-server/internal/logger"
+)
+
+// Context trimming strategies
+const (
+	StrategyNone          = "none"           // send the whole history
+	StrategySlidingWindow = "sliding_window" // keep the most recent messages
+	StrategyFirstRecent   = "first_recent"   // keep the first question and the most recent messages
+	StrategySummary       = "summary"        // replace older messages with a rolling summary
+)
+
+// ErrUnknownStrategy is returned for a trimming strategy that does not exist
+var ErrUnknownStrategy = errors.New("unknown context strategy")
+
+// Options selects how a persona's context is kept within its token limit
+type Options struct {
+	Strategy  string
+	MaxTokens int     // limit of the system prompt and history, 0 for no limit
+	Counter   Counter // nil for Estimate
+}
+
+// SummarySpeaker is the speaker of the summaries written by the summary strategy
+const SummarySpeaker = "summary"
+
+// Trimmer fits a conversation history into a token limit before it is sent to
+// the model. The returned history holds the kept messages in order, and
+// possibly a summary of the dropped ones in their place. Trim fills in the
+// token count of every message it counts.
+type Trimmer interface {
+	Trim(ctx context.Context, system string, history []llm.Message) ([]llm.Message, error)
+}
+
+// New returns the trimmer of opts.Strategy. The summary strategy writes its
+// summaries with backend and settings; the others ignore them.
+func New(opts Options, backend llm.Backend, settings llm.Settings) (Trimmer, error) {
+	counter := opts.Counter
+	if counter == nil {
+		counter = Estimate{}
+	}
+	limit := limit{counter: counter, maxTokens: opts.MaxTokens}
+
+	switch opts.Strategy {
+	case StrategyNone, "":
+		return None{}, nil
+	case StrategySlidingWindow:
+		return &SlidingWindow{limit}, nil
+	case StrategyFirstRecent:
+		return &FirstRecent{limit}, nil
+	case StrategySummary:
+		return &Summary{limit: limit, backend: backend, settings: settings}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownStrategy, opts.Strategy)
+}
+
+// limit is the token limit shared by the strategies
+type limit struct {
+	counter   Counter
+	maxTokens int
+}
+
+// count returns the token count of a message, counting it on first use
+func (l limit) count(m *llm.Message) int {
+	if m.Tokens == 0 {
+		m.Tokens = l.counter.Count(m.Content)
+	}
+	return m.Tokens
+}
+
+// sum returns the token count of all messages
+func (l limit) sum(history []llm.Message) int {
+	n := 0
+	for i := range history {
+		n += l.count(&history[i])
+	}
+	return n
+}
+
+// available returns the tokens left for the history after the system prompt
+// and the given messages, or -1 if there is no limit
+func (l limit) available(system string, kept ...llm.Message) int {
+	if l.maxTokens <= 0 {
+		return -1
+	}
+	return max(l.maxTokens-total(l.counter, system)-l.sum(kept), 0)
+}
+
+// recent returns the index of the oldest message of the longest suffix of
+// history that fits in tokens. The last message is always kept.
+func (l limit) recent(history []llm.Message, tokens int) int {
+	from := len(history)
+	for from > 0 {
+		n := l.count(&history[from-1])
+		if n > tokens && from < len(history) {
+			break
+		}
+		tokens -= n
+		from--
+	}
+	return from
+}
+
+// None sends the whole history
+type None struct{}
+
+// Trim returns history unchanged
+func (None) Trim(ctx context.Context, system string, history []llm.Message) ([]llm.Message, error) {
+	return history, nil
+}
+
+// SlidingWindow keeps the most recent messages that fit the limit
+type SlidingWindow struct {
+	limit
+}
+
+// Trim drops the oldest messages that do not fit
+func (w *SlidingWindow) Trim(ctx context.Context, system string, history []llm.Message) ([]llm.Message, error) {
+	tokens := w.available(system)
+	if tokens < 0 {
+		return history, nil
+	}
+	return history[w.recent(history, tokens):], nil
+}
+
+// FirstRecent keeps the first message, usually the operator's question that set
+// the topic, and the most recent messages that fit the limit
+type FirstRecent struct {
+	limit
+}
+
+// Trim drops the oldest messages after the first that do not fit
+func (w *FirstRecent) Trim(ctx context.Context, system string, history []llm.Message) ([]llm.Message, error) {
+	if len(history) < 2 {
+		return history, nil
+	}
+	tokens := w.available(system, history[0])
+	if tokens < 0 {
+		return history, nil
+	}
+	rest := history[1:]
+	return append([]llm.Message{history[0]}, rest[w.recent(rest, tokens):]...), nil
+}
+
+// summaryPrompt is the system prompt of the queries that write summaries
+const summaryPrompt = "Summarize the conversation below for a participant who will continue it. " +
+	"Keep the topic, the questions asked, the key facts and conclusions, and any open " +
+	"threads. Reply with only the summary in plain text, in at most 200 words."
+
+// Summary keeps the most recent messages and replaces the older ones with a
+// summary written by the model. The summary is the first message of the
+// returned history, so it rolls into the next summary when the history
+// outgrows the limit again.
+type Summary struct {
+	limit
+	backend  llm.Backend
+	settings llm.Settings
+}
+
+// Trim summarizes the oldest messages once the history no longer fits. Half
+// of the limit is kept for recent messages, so a new summary is only needed
+// every few turns. If the summary fails, the oldest messages are dropped
+// instead, unless ctx was cancelled, in which case its error is returned.
+func (w *Summary) Trim(ctx context.Context, system string, history []llm.Message) ([]llm.Message, error) {
+	tokens := w.available(system)
+	if tokens < 0 || w.sum(history) <= tokens {
+		return history, nil
+	}
+
+	from := w.recent(history, tokens/2)
+	if from == 0 {
+		return history, nil
+	}
+	summary, err := w.summarize(ctx, history[:from])
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil {
+		drop := w.recent(history, tokens)
+		logger.Printf("Failed to summarize the context, dropping %d messages: %v", drop, err)
+		return history[drop:], nil
+	}
+	return append([]llm.Message{summary}, history[from:]...), nil
+}
+
+// summarize asks the model for a summary of messages. They are sent as a
+// single transcript, so the model summarizes the conversation rather than
+// continuing it. The summary is a user message, as it is not any persona's turn.
+func (w *Summary) summarize(ctx context.Context, messages []llm.Message) (llm.Message, error) {
+	transcript := []llm.Message{{
+		Role:    llm.RoleUser,
+		Content: strings.Join(llm.Contents(messages), "\n\n"),
+		Time:    time.Now(),
+	}}
+	output, err := w.backend.QueryText(ctx, summaryPrompt, transcript, w.settings.Model, w.settings.Options())
+	if err != nil {
+		return llm.Message{}, err
+	}
+	text := strings.TrimSpace(output)
+	if text == "" {
+		return llm.Message{}, errors.New("empty summary")
+	}
+	return llm.Message{
+		Speaker: SummarySpeaker,
+		Role:    llm.RoleUser,
+		Content: "<summary>Summary of the conversation so far: " + text + "</summary>",
+		Time:    time.Now(),
+	}, nil
+}
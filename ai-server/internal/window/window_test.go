@@ -0,0 +1,351 @@
+package window
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/dmh2000/ai-server/internal/llm"
+)
+
+// letters counts one token per byte, so the tests can size messages exactly
+type letters struct{}
+
+func (letters) Count(text string) int { return len(text) }
+
+// messages returns a history with the given contents
+func messages(contents ...string) []llm.Message {
+	history := make([]llm.Message, 0, len(contents))
+	for _, c := range contents {
+		history = append(history, llm.Message{Role: llm.RoleUser, Content: c})
+	}
+	return history
+}
+
+// summarizer is a backend that replies with a fixed summary
+type summarizer struct {
+	reply   string
+	err     error
+	cancel  context.CancelFunc // called during the query, if set
+	queries [][]llm.Message
+}
+
+func (s *summarizer) QueryText(ctx context.Context, system string, history []llm.Message, model string, options llm.Options) (string, error) {
+	s.queries = append(s.queries, history)
+	if s.cancel != nil {
+		s.cancel()
+	}
+	return s.reply, s.err
+}
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"abcdefgh", 2},
+	}
+	for _, tt := range tests {
+		if got := (Estimate{}).Count(tt.text); got != tt.want {
+			t.Errorf("Estimate.Count(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTotal(t *testing.T) {
+	if got := total(letters{}, "ab", "", "cde"); got != 5 {
+		t.Errorf("total = %d, want 5", got)
+	}
+	if got := total(letters{}); got != 0 {
+		t.Errorf("total of nothing = %d, want 0", got)
+	}
+}
+
+func TestCountFillsTokens(t *testing.T) {
+	l := limit{counter: letters{}}
+	history := messages("abc", "de")
+	history[1].Tokens = 7 // already counted
+	if got := l.sum(history); got != 10 {
+		t.Errorf("sum = %d, want 10", got)
+	}
+	if history[0].Tokens != 3 {
+		t.Errorf("Tokens = %d, want 3", history[0].Tokens)
+	}
+}
+
+func TestAvailable(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxTokens int
+		system    string
+		kept      []llm.Message
+		want      int
+	}{
+		{"no limit", 0, "system", nil, -1},
+		{"system only", 10, "sys", nil, 7},
+		{"system and kept", 10, "sys", messages("ab"), 5},
+		{"exactly full", 5, "sys", messages("ab"), 0},
+		{"over full", 4, "sys", messages("ab"), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := limit{counter: letters{}, maxTokens: tt.maxTokens}
+			if got := l.available(tt.system, tt.kept...); got != tt.want {
+				t.Errorf("available = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecent(t *testing.T) {
+	tests := []struct {
+		name    string
+		history []string
+		tokens  int
+		want    int
+	}{
+		{"empty", nil, 10, 0},
+		{"all fit", []string{"aaa", "bbb", "ccc"}, 9, 0},
+		{"one over", []string{"aaa", "bbb", "ccc"}, 8, 1},
+		{"only the last fits", []string{"aaa", "bbb", "ccc"}, 5, 2},
+		{"last kept when nothing fits", []string{"aaa", "bbb", "ccc"}, 0, 2},
+		{"single message over", []string{"aaaaaa"}, 2, 0},
+		{"stops at the first that does not fit", []string{"a", "bbbbb", "c"}, 3, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := limit{counter: letters{}}
+			if got := l.recent(messages(tt.history...), tt.tokens); got != tt.want {
+				t.Errorf("recent = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		strategy string
+		want     Trimmer
+	}{
+		{"", None{}},
+		{StrategyNone, None{}},
+		{StrategySlidingWindow, &SlidingWindow{limit{counter: Estimate{}, maxTokens: 100}}},
+		{StrategyFirstRecent, &FirstRecent{limit{counter: Estimate{}, maxTokens: 100}}},
+		{StrategySummary, &Summary{limit: limit{counter: Estimate{}, maxTokens: 100}}},
+	}
+	for _, tt := range tests {
+		got, err := New(Options{Strategy: tt.strategy, MaxTokens: 100}, nil, llm.Settings{})
+		if err != nil {
+			t.Errorf("New(%q): %v", tt.strategy, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("New(%q) = %#v, want %#v", tt.strategy, got, tt.want)
+		}
+	}
+
+	if _, err := New(Options{Strategy: "everything"}, nil, llm.Settings{}); !errors.Is(err, ErrUnknownStrategy) {
+		t.Errorf("New(unknown) error = %v, want %v", err, ErrUnknownStrategy)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxTokens int
+		system    string
+		history   []string
+		want      []string
+	}{
+		{"no limit", 0, "sys", []string{"aaaa", "bbbb", "cccc"}, []string{"aaaa", "bbbb", "cccc"}},
+		{"empty", 10, "sys", nil, []string{}},
+		{"exactly fits", 15, "sys", []string{"aaaa", "bbbb", "cccc"}, []string{"aaaa", "bbbb", "cccc"}},
+		{"one token over", 14, "sys", []string{"aaaa", "bbbb", "cccc"}, []string{"bbbb", "cccc"}},
+		{"only the last fits", 7, "sys", []string{"aaaa", "bbbb", "cccc"}, []string{"cccc"}},
+		{"system fills the limit", 3, "sys", []string{"aaaa", "bbbb", "cccc"}, []string{"cccc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &SlidingWindow{limit{counter: letters{}, maxTokens: tt.maxTokens}}
+			got, err := w.Trim(context.Background(), tt.system, messages(tt.history...))
+			if err != nil {
+				t.Fatalf("Trim: %v", err)
+			}
+			if contents := llm.Contents(got); !reflect.DeepEqual(contents, tt.want) {
+				t.Errorf("Trim = %q, want %q", contents, tt.want)
+			}
+		})
+	}
+}
+
+func TestFirstRecent(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxTokens int
+		history   []string
+		want      []string
+	}{
+		{"no limit", 0, []string{"qq", "aaaa", "bbbb"}, []string{"qq", "aaaa", "bbbb"}},
+		{"single message", 1, []string{"qqqq"}, []string{"qqqq"}},
+		{"exactly fits", 10, []string{"qq", "aaaa", "bbbb"}, []string{"qq", "aaaa", "bbbb"}},
+		{"one token over", 9, []string{"qq", "aaaa", "bbbb"}, []string{"qq", "bbbb"}},
+		{"first fills the limit", 2, []string{"qq", "aaaa", "bbbb"}, []string{"qq", "bbbb"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &FirstRecent{limit{counter: letters{}, maxTokens: tt.maxTokens}}
+			got, err := w.Trim(context.Background(), "", messages(tt.history...))
+			if err != nil {
+				t.Fatalf("Trim: %v", err)
+			}
+			if contents := llm.Contents(got); !reflect.DeepEqual(contents, tt.want) {
+				t.Errorf("Trim = %q, want %q", contents, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummary(t *testing.T) {
+	const summary = "<summary>Summary of the conversation so far: they talked</summary>"
+	failed := errors.New("model unavailable")
+
+	tests := []struct {
+		name      string
+		maxTokens int
+		history   []string
+		reply     string
+		err       error
+		cancel    bool // cancel the context during the summary query
+		want      []string
+		wantErr   error
+		summaries []string // the transcript of each summary query
+	}{
+		{
+			name:      "no limit",
+			maxTokens: 0,
+			history:   []string{"aaaa", "bbbb", "cccc"},
+			want:      []string{"aaaa", "bbbb", "cccc"},
+		},
+		{
+			name:      "exactly fits",
+			maxTokens: 12,
+			history:   []string{"aaaa", "bbbb", "cccc"},
+			want:      []string{"aaaa", "bbbb", "cccc"},
+		},
+		{
+			name:      "one token over",
+			maxTokens: 11,
+			history:   []string{"aaaa", "bbbb", "cccc"},
+			reply:     " they talked\n",
+			want:      []string{summary, "cccc"},
+			summaries: []string{"aaaa\n\nbbbb"},
+		},
+		{
+			name:      "nothing before the recent messages",
+			maxTokens: 6,
+			history:   []string{"aaaaaaaa"},
+			want:      []string{"aaaaaaaa"},
+		},
+		{
+			name:      "summary fails",
+			maxTokens: 10,
+			history:   []string{"aaaa", "bbbb", "cccc"},
+			err:       failed,
+			want:      []string{"bbbb", "cccc"},
+			summaries: []string{"aaaa\n\nbbbb"},
+		},
+		{
+			name:      "summary empty",
+			maxTokens: 10,
+			history:   []string{"aaaa", "bbbb", "cccc"},
+			reply:     "  \n",
+			want:      []string{"bbbb", "cccc"},
+			summaries: []string{"aaaa\n\nbbbb"},
+		},
+		{
+			name:      "cancelled while summarizing",
+			maxTokens: 10,
+			history:   []string{"aaaa", "bbbb", "cccc"},
+			err:       context.Canceled,
+			cancel:    true,
+			wantErr:   context.Canceled,
+			summaries: []string{"aaaa\n\nbbbb"},
+		},
+		{
+			name:      "cancelled after a summary",
+			maxTokens: 10,
+			history:   []string{"aaaa", "bbbb", "cccc"},
+			reply:     "they talked",
+			cancel:    true,
+			wantErr:   context.Canceled,
+			summaries: []string{"aaaa\n\nbbbb"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			backend := &summarizer{reply: tt.reply, err: tt.err}
+			if tt.cancel {
+				backend.cancel = cancel
+			}
+			w := &Summary{limit: limit{counter: letters{}, maxTokens: tt.maxTokens}, backend: backend}
+
+			got, err := w.Trim(ctx, "", messages(tt.history...))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Trim error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if got != nil {
+					t.Errorf("Trim = %q, want nil", llm.Contents(got))
+				}
+			} else if contents := llm.Contents(got); !reflect.DeepEqual(contents, tt.want) {
+				t.Errorf("Trim = %q, want %q", contents, tt.want)
+			}
+
+			var summaries []string
+			for _, q := range backend.queries {
+				if len(q) != 1 || q[0].Role != llm.RoleUser {
+					t.Errorf("summary query history = %+v, want a single user message", q)
+					continue
+				}
+				summaries = append(summaries, q[0].Content)
+			}
+			if !reflect.DeepEqual(summaries, tt.summaries) {
+				t.Errorf("summary queries = %q, want %q", summaries, tt.summaries)
+			}
+		})
+	}
+}
+
+func TestSummaryRolls(t *testing.T) {
+	backend := &summarizer{reply: "s"}
+	w := &Summary{limit: limit{counter: letters{}, maxTokens: 60}, backend: backend}
+
+	first, err := w.Trim(context.Background(), "", messages("aaaaaaaaaaaaaaaaaaaa", "bbbbbbbbbbbbbbbbbbbb", "cccccccccccccccccccc", "dddd"))
+	if err != nil {
+		t.Fatalf("Trim: %v", err)
+	}
+	if len(first) != 3 || first[0].Speaker != SummarySpeaker {
+		t.Fatalf("Trim = %q, want a summary and two recent messages", llm.Contents(first))
+	}
+
+	second, err := w.Trim(context.Background(), "", append(first, messages("eeeeeeeeeeeeeeeeeeee", "ffffffffffffffffffff")...))
+	if err != nil {
+		t.Fatalf("Trim: %v", err)
+	}
+	if len(backend.queries) != 2 {
+		t.Fatalf("%d summary queries, want 2", len(backend.queries))
+	}
+	if got := backend.queries[1][0].Content; got[:len(first[0].Content)] != first[0].Content {
+		t.Errorf("second summary of %q does not start with the first summary", got)
+	}
+	if second[0].Speaker != SummarySpeaker {
+		t.Errorf("Trim = %q, want a summary first", llm.Contents(second))
+	}
+}
@@ -1,14 +1,18 @@
 import { useState, useCallback } from 'react';
-import { useWebSocket } from './services/websocketClient';
+import { useWebSocket, MESSAGE_TYPE_HUMAN_TURN } from './services/websocketClient';
 import type { Message } from './services/websocketClient';
 import { MessageDisplay } from './components/MessageDisplay';
 import './App.css';
 
 function App() {
   const [currentMessage, setCurrentMessage] = useState<Message | null>(null);
+  const [isMyTurn, setIsMyTurn] = useState(false);
+  const [replyText, setReplyText] = useState('');
 
   const handleMessage = useCallback((message: Message) => {
     console.log('Received message:', message);
+    // A human turn shows the question; any other message means the turn is over
+    setIsMyTurn(message.type === MESSAGE_TYPE_HUMAN_TURN);
     setCurrentMessage(message);
   }, []);
 
@@ -16,12 +20,19 @@ function App() {
     window.location.reload();
   }, []);
 
-  const { isConnected, sendReset } = useWebSocket(handleMessage, handleResetAck);
+  const { isConnected, send, sendReset } = useWebSocket(handleMessage, handleResetAck);
 
   const handleRestart = () => {
     sendReset();
   };
 
+  const handleReply = () => {
+    if (!replyText.trim()) return;
+    send({ text: replyText.trim() });
+    setReplyText('');
+    setIsMyTurn(false);
+  };
+
   return (
     <div >
       <header role="banner">
@@ -48,7 +59,37 @@ function App() {
       </header>
 
       <main role="main">
-        <MessageDisplay text={currentMessage?.text || ''} />
+        <MessageDisplay
+          text={currentMessage?.text || ''}
+          id={currentMessage?.id}
+          audio={currentMessage?.audio}
+        />
+
+        {isMyTurn && (
+          <form
+            className="human-reply"
+            onSubmit={(e) => {
+              e.preventDefault();
+              handleReply();
+            }}
+          >
+            <input
+              type="text"
+              value={replyText}
+              onChange={(e) => setReplyText(e.target.value)}
+              placeholder="Your answer..."
+              aria-label="Your answer"
+              autoFocus
+            />
+            <button
+              type="submit"
+              className="restart-button"
+              disabled={!isConnected || !replyText.trim()}
+            >
+              Reply
+            </button>
+          </form>
+        )}
       </main>
     </div>
   );
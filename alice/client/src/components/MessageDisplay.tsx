@@ -2,9 +2,13 @@ import { useEffect, useState } from 'react';
 
 interface MessageDisplayProps {
   text: string;
+  // ID of a streamed message; its deltas update the text without restarting the animation
+  id?: string;
+  // URL of the spoken message, played when it arrives
+  audio?: string;
 }
 
-export function MessageDisplay({ text }: MessageDisplayProps) {
+export function MessageDisplay({ text, id, audio }: MessageDisplayProps) {
   const [displayText, setDisplayText] = useState('');
   const [isAnimating, setIsAnimating] = useState(false);
 
@@ -24,7 +28,7 @@ export function MessageDisplay({ text }: MessageDisplayProps) {
     <div className="message-display" role="region" aria-label="Message display">
       <h2>Message:</h2>
       <p
-        key={displayText}
+        key={id ?? displayText}
         className={isAnimating ? 'animating' : ''}
         role="status"
         aria-live="polite"
@@ -32,6 +36,7 @@ export function MessageDisplay({ text }: MessageDisplayProps) {
       >
         {displayText}
       </p>
+      {audio && <audio key={audio} src={audio} autoPlay controls />}
     </div>
   );
 }
@@ -3,16 +3,44 @@ import { useEffect, useRef, useState, useCallback } from 'react';
 export interface Message {
   type?: string;
   text?: string;
+  reason?: string;
+  id?: string;
+  seq?: number;
+  audio?: string;
+  // conversation and generation the message belongs to; a reset starts a new generation
+  conversation?: string;
+  generation?: number;
 }
 
 // WSS FOR DEPLOY, WS FOR TEST
 const WS_URL =
   (window.location.protocol === 'https:' ? 'wss://' : 'ws://') +
   window.location.host +
-  '/ws';
+  '/ws/alice';
+
+// Conversation to join (?conversation=...) or stored transcript to replay
+// (?replay=...), taken from the page URL. Clients without either share the
+// server's default conversation. A new conversation is held between the
+// ?asker=... and ?answerer=... personas, or the server's default ones, and
+// ?human=asker or ?human=answerer lets a person play that side.
+const PAGE_PARAMS = new URLSearchParams(window.location.search);
+const WS_PARAMS = new URLSearchParams();
+for (const name of ['conversation', 'replay', 'asker', 'answerer', 'human']) {
+  const value = PAGE_PARAMS.get(name);
+  if (value) {
+    WS_PARAMS.set(name, value);
+  }
+}
+const WS_QUERY = WS_PARAMS.toString();
+const WS_CONVERSATION_URL = WS_QUERY ? `${WS_URL}?${WS_QUERY}` : WS_URL;
 
 export const MESSAGE_TYPE_RESET = 'reset';
 export const MESSAGE_TYPE_RESET_ACK = 'reset_ack';
+export const MESSAGE_TYPE_DELTA = 'delta';
+export const MESSAGE_TYPE_FINAL = 'final';
+
+// Sent when it is the person's turn to reply, with the text to reply to
+export const MESSAGE_TYPE_HUMAN_TURN = 'human_turn';
 
 export function useWebSocket(onMessage: (message: Message) => void, onResetAck?: () => void) {
   const wsRef = useRef<WebSocket | null>(null);
@@ -21,6 +49,11 @@ export function useWebSocket(onMessage: (message: Message) => void, onResetAck?:
   const onMessageRef = useRef(onMessage);
   const onResetAckRef = useRef(onResetAck);
   const connectRef = useRef<() => void>(() => { });
+  // text of the response currently being streamed
+  const streamRef = useRef<{ id?: string; text: string }>({ text: '' });
+  // latest generation of the conversation; messages of earlier ones are stale.
+  // It is learned anew on every connection, the server may have restarted.
+  const generationRef = useRef(0);
 
   // Update refs when callbacks change
   useEffect(() => {
@@ -34,10 +67,12 @@ export function useWebSocket(onMessage: (message: Message) => void, onResetAck?:
   useEffect(() => {
     const connect = () => {
       try {
-        const ws = new WebSocket(WS_URL);
+        const ws = new WebSocket(WS_CONVERSATION_URL);
 
         ws.onopen = () => {
           console.log('WebSocket connected');
+          generationRef.current = 0;
+          streamRef.current = { text: '' };
           setIsConnected(true);
         };
 
@@ -46,12 +81,30 @@ export function useWebSocket(onMessage: (message: Message) => void, onResetAck?:
             const message = JSON.parse(event.data) as Message;
             console.log('Received message:', message);
 
+            if ((message.generation ?? 0) < generationRef.current) {
+              console.log('Dropping message from before the last reset');
+              return;
+            }
+            generationRef.current = message.generation ?? generationRef.current;
+
             if (message.type === MESSAGE_TYPE_RESET_ACK) {
               console.log('Reset acknowledged by server');
               onResetAckRef.current?.();
               return;
             }
 
+            // Streamed responses arrive as deltas; show the text received so far
+            if (message.type === MESSAGE_TYPE_DELTA) {
+              const stream = streamRef.current;
+              const text = (stream.id === message.id ? stream.text : '') + (message.text ?? '');
+              streamRef.current = { id: message.id, text };
+              onMessageRef.current({ ...message, text });
+              return;
+            }
+            if (message.type === MESSAGE_TYPE_FINAL) {
+              streamRef.current = { text: '' };
+            }
+
             onMessageRef.current(message);
           } catch (error) {
             console.error('Failed to parse message:', error);
@@ -98,9 +151,12 @@ export function useWebSocket(onMessage: (message: Message) => void, onResetAck?:
     };
   }, []);
 
+  // Messages are labeled with the latest generation seen, so the server can
+  // reject those written before a reset
   const send = useCallback((data: Message) => {
     if (wsRef.current && wsRef.current.readyState === WebSocket.OPEN) {
-      wsRef.current.send(JSON.stringify(data));
+      const generation = generationRef.current || undefined;
+      wsRef.current.send(JSON.stringify({ ...data, generation }));
     }
   }, []);
 
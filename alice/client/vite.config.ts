@@ -6,4 +6,13 @@ export default defineConfig({
   base: "/alice/",
   plugins: [react()],
   publicDir: 'public',
+  server: {
+    // forward WebSocket connections, synthesized audio and transcripts to
+    // the ai-server during development
+    proxy: {
+      '/ws': { target: 'ws://localhost:8000', ws: true },
+      '/audio': 'http://localhost:8000',
+      '/conversations': 'http://localhost:8000',
+    },
+  },
 })
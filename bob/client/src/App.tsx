@@ -1,17 +1,50 @@
 import { useState, useRef, useMemo, useCallback } from 'react';
-import { useWebSocket } from './services/websocketClient';
+import {
+  useWebSocket,
+  MESSAGE_TYPE_INJECT,
+  MESSAGE_TYPE_OVERRIDE,
+  MESSAGE_TYPE_TOPIC,
+  MESSAGE_TYPE_PAUSE,
+  MESSAGE_TYPE_RESUME,
+  MESSAGE_TYPE_STEP,
+  MESSAGE_TYPE_HUMAN_TURN,
+} from './services/websocketClient';
 import type { Message } from './services/websocketClient';
 import { MessageDisplay } from './components/MessageDisplay';
 import './App.css';
 
+// Ways the operator can steer the running conversation
+const OPERATOR_ACTIONS = [
+  { value: 'note-asker', label: 'Note to Bob', type: MESSAGE_TYPE_INJECT, target: 'asker' },
+  { value: 'note-answerer', label: 'Note to Alice', type: MESSAGE_TYPE_INJECT, target: 'answerer' },
+  { value: 'override', label: 'Replace next question', type: MESSAGE_TYPE_OVERRIDE },
+  { value: 'topic', label: 'Change topic', type: MESSAGE_TYPE_TOPIC },
+];
+
 function App() {
   const [currentMessage, setCurrentMessage] = useState<Message | null>(null);
   const [isStarted, setIsStarted] = useState(false);
   const [inputText, setInputText] = useState('');
+  const [operatorAction, setOperatorAction] = useState(OPERATOR_ACTIONS[0].value);
+  const [operatorText, setOperatorText] = useState('');
+  const [isHeld, setIsHeld] = useState(false);
+  const [isMyTurn, setIsMyTurn] = useState(false);
+  const [replyText, setReplyText] = useState('');
   const textareaRef = useRef<HTMLTextAreaElement>(null);
 
   const handleMessage = useCallback((message: Message) => {
     console.log('Received message:', message);
+    // Acknowledgments of the presenter controls leave the message shown
+    if (message.type === MESSAGE_TYPE_PAUSE || message.type === MESSAGE_TYPE_STEP) {
+      setIsHeld(true);
+      return;
+    }
+    if (message.type === MESSAGE_TYPE_RESUME) {
+      setIsHeld(false);
+      return;
+    }
+    // A human turn shows the answer; any other message means the turn is over
+    setIsMyTurn(message.type === MESSAGE_TYPE_HUMAN_TURN);
     setCurrentMessage(message);
   }, []);
 
@@ -52,6 +85,20 @@ function App() {
     setIsStarted(true);
   };
 
+  const handleReply = () => {
+    if (!replyText.trim()) return;
+    send({ text: replyText.trim() });
+    setReplyText('');
+    setIsMyTurn(false);
+  };
+
+  const handleOperatorSend = () => {
+    const action = OPERATOR_ACTIONS.find((a) => a.value === operatorAction);
+    if (!action || !operatorText.trim()) return;
+    send({ type: action.type, target: action.target, text: operatorText.trim() });
+    setOperatorText('');
+  };
+
   if (!isStarted) {
     return (
       <div className="App">
@@ -102,6 +149,22 @@ function App() {
           >
             Restart
           </button>
+          <button
+            className="restart-button"
+            onClick={() => send({ type: isHeld ? MESSAGE_TYPE_RESUME : MESSAGE_TYPE_PAUSE })}
+            disabled={!isConnected}
+            title={isHeld ? 'Resume the conversation' : 'Pause before the next turn'}
+          >
+            {isHeld ? 'Resume' : 'Pause'}
+          </button>
+          <button
+            className="restart-button"
+            onClick={() => send({ type: MESSAGE_TYPE_STEP })}
+            disabled={!isConnected}
+            title="Allow one more turn, then pause"
+          >
+            Step
+          </button>
           <div
             className={`status ${isConnected ? 'connected' : 'disconnected'}`}
             role="status"
@@ -114,7 +177,69 @@ function App() {
       </header>
 
       <main role="main">
-        <MessageDisplay text={currentMessage?.text || ''} />
+        <MessageDisplay
+          text={currentMessage?.text || ''}
+          id={currentMessage?.id}
+          audio={currentMessage?.audio}
+        />
+
+        {isMyTurn && (
+          <form
+            className="human-reply"
+            onSubmit={(e) => {
+              e.preventDefault();
+              handleReply();
+            }}
+          >
+            <input
+              type="text"
+              value={replyText}
+              onChange={(e) => setReplyText(e.target.value)}
+              placeholder="Your next question..."
+              aria-label="Your next question"
+              autoFocus
+            />
+            <button
+              type="submit"
+              className="restart-button"
+              disabled={!isConnected || !replyText.trim()}
+            >
+              Ask
+            </button>
+          </form>
+        )}
+
+        <form
+          className="operator-controls"
+          onSubmit={(e) => {
+            e.preventDefault();
+            handleOperatorSend();
+          }}
+        >
+          <select
+            value={operatorAction}
+            onChange={(e) => setOperatorAction(e.target.value)}
+            aria-label="Operator action"
+          >
+            {OPERATOR_ACTIONS.map((a) => (
+              <option key={a.value} value={a.value}>{a.label}</option>
+            ))}
+          </select>
+          <input
+            type="text"
+            value={operatorText}
+            onChange={(e) => setOperatorText(e.target.value)}
+            placeholder="Steer the conversation..."
+            aria-label="Operator message"
+          />
+          <button
+            type="submit"
+            className="restart-button"
+            disabled={!isConnected || !operatorText.trim()}
+          >
+            Send
+          </button>
+        </form>
       </main>
     </div>
   );
@@ -21,17 +21,7 @@ echo "build ai-server/cmd"
 go build -o ../ai-server
 popd
 
-# start alice/server 
-pushd alice/server
-python server.py --port 8001 --dir ../client/dist &
-popd
-
-# start bob/server 
-pushd bob/server
-python server.py --port 8002 --dir ../client/dist &
-popd
-
-# start ai-server
+# start ai-server (also serves the built alice and bob clients)
 pushd ai-server
-./ai-server &
+ALICE_STATIC_DIR=../alice/client/dist BOB_STATIC_DIR=../bob/client/dist ./ai-server &
 popd
@@ -1,17 +1,9 @@
 @echo off
 
 
-REM start alice/server
-pushd alice
-start "Alice-Server" python server.py --port 8001 --dir .
-popd
-
-REM start bob/server
-pushd bob
-start "Bob-Server" python server.py --port 8002 --dir .
-popd
-
-REM start ai-server
+REM start ai-server (also serves the built alice and bob clients)
+set ALICE_STATIC_DIR=..\alice
+set BOB_STATIC_DIR=..\bob
 pushd ai-server
 start "AI-Server" ai-server.exe
 popd
@@ -3,19 +3,9 @@
 # stop all services
 ./export-kill.sh
 
-# start alice/server 
-pushd alice/server
-python server.py --port 8001 --dir . &
-popd
-
-# start bob/server 
-pushd bob/server
-python server.py --port 8002 --dir . &
-popd
-
-# start ai-server
+# start ai-server (also serves the built alice and bob clients)
 pushd ai-server
-./ai-server &
+ALICE_STATIC_DIR=../alice BOB_STATIC_DIR=../bob ./ai-server &
 popd
 
 # start nginx
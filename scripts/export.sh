@@ -31,11 +31,9 @@ mkdir -p dist/ai-server
 
 # export alice
 cp -r alice/client/dist/* dist/alice
-cp -r alice/server/server.py dist/alice
 
 # export bob
 cp -r bob/client/dist/* dist/bob
-cp -r bob/server/server.py dist/bob
 
 # export ai-server
 cp ai-server/ai-server dist/ai-server
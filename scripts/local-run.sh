@@ -3,19 +3,9 @@
 # stop all services
 ./scripts/local-kill.sh
 
-# start alice/server 
-pushd alice/server
-python server.py --port 8001 --dir ../client/dist &
-popd
-
-# start bob/server 
-pushd bob/server
-python server.py --port 8002 --dir ../client/dist &
-popd
-
-# start ai-server
+# start ai-server (also serves the built alice and bob clients)
 pushd ai-server
-./ai-server &
+ALICE_STATIC_DIR=../alice/client/dist BOB_STATIC_DIR=../bob/client/dist ./ai-server &
 popd
 
 # start nginx
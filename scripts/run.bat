@@ -3,17 +3,9 @@
 REM stop all services
 call kill.bat >nul 2>&1
 
-REM start alice/server
-cd alice\server
-start python server.py --port 8001 --dir ..\client\dist
-cd ..\..
-
-REM start bob/server
-cd bob\server
-start python server.py --port 8002 --dir ..\client\dist
-cd ..\..
-
-REM start ai-server
+REM start ai-server (also serves the built alice and bob clients)
+set ALICE_STATIC_DIR=..\alice\client\dist
+set BOB_STATIC_DIR=..\bob\client\dist
 
 cd ai-server
 start ai-server.exe
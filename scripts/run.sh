@@ -8,17 +8,7 @@ pgrep -a ai-server | grep ai-server
 pgrep -a ai-server | grep ai-server  | awk '{print $1}' | xargs kill 2> /dev/null
 
 
-# start alice/server 
-pushd alice/server
-python server.py --port 8001 --dir ../client/dist &
-popd
-
-# start bob/server 
-pushd bob/server
-python server.py --port 8002 --dir ../client/dist &
-popd
-
-# start ai-server
+# start ai-server (also serves the built alice and bob clients)
 pushd ai-server
-./ai-server &
+ALICE_STATIC_DIR=../alice/client/dist BOB_STATIC_DIR=../bob/client/dist ./ai-server &
 popd